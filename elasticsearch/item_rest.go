@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/dahernan/gopherscraper/model"
 )
@@ -40,6 +42,11 @@ func ItemEndpoint(index string, indexType string, itemId string) (string, error)
 
 }
 func ItemEndpointWithItem(index string, item *model.Item) (string, error) {
+	// the scraper sets the index as host/id, the host can be the final url
+	if parts := strings.SplitN(item.Index, "/", 2); len(parts) == 2 {
+		return ItemEndpoint(index, parts[0], parts[1])
+	}
+
 	u, err := url.Parse(item.ScrapUrl)
 	if err != nil {
 		return "", err
@@ -138,6 +145,45 @@ func (ie *ItemElastic) Search(indexType string, query interface{}) (interface{},
 
 }
 
+// items of the type scraped before the time, the oldest first, paged from the offset
+func (ie *ItemElastic) StaleItems(indexType string, before time.Time, from int, size int) ([]*model.Item, error) {
+	endpoint, err := ie.funcEndpoint(ie.index, indexType, "_search")
+	if err != nil {
+		return nil, err
+	}
+
+	query := map[string]interface{}{
+		"from": from,
+		"size": size,
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				"lastScrap": map[string]interface{}{"lt": before.UTC().Format(time.RFC3339)},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"lastScrap": "asc"},
+		},
+	}
+
+	response, err := ie.handler.Query(endpoint, query)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*model.Item, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		var item model.Item
+		err = NewModelFromRaw(hit.Source, &item)
+		if err != nil {
+			return nil, err
+		}
+		item.Id = hit.Id
+		items = append(items, &item)
+	}
+
+	return items, nil
+}
+
 func (ie *ItemElastic) Head(indexType string, itemId string) (bool, error) {
 	endpoint, err := ie.funcEndpoint(ie.index, indexType, itemId)
 	if err != nil {
@@ -169,3 +215,16 @@ func (i *ItemElastic) Put(item *model.Item) (ElasticResponse, error) {
 func (i *ItemElastic) Post(item *model.Item) (ElasticResponse, error) {
 	return i.send("POST", item)
 }
+
+// partial update of the lastScrap of an item scraped again without changes
+func (i *ItemElastic) UpdateLastScrap(item *model.Item) (ElasticResponse, error) {
+	endpoint, err := i.funcEndpointItem(i.index, item)
+	if err != nil {
+		return ElasticResponse{}, err
+	}
+
+	update := map[string]interface{}{
+		"doc": map[string]interface{}{"lastScrap": item.LastScrap},
+	}
+	return i.handler.Send("POST", endpoint+"/_update", update)
+}
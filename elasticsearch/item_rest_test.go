@@ -3,7 +3,11 @@ package elastic
 import (
 	"bytes"
 	"encoding/json"
+	"net/http"
 	"testing"
+	"time"
+
+	elasticrest "github.com/dahernan/gopherscraper/jsonrequest"
 
 	"github.com/dahernan/gopherscraper/model"
 	. "github.com/smartystreets/goconvey/convey"
@@ -43,3 +47,64 @@ func TestMarshal(t *testing.T) {
 
 	})
 }
+
+const staleResponse = `
+{
+"took":3,
+"hits":{
+	"total":2,
+	"hits":[
+		{"_index":"gopherscrap","_type":"www.shop.com","_id":"p1","_source":{"id":"p1","link":"http://www.shop.com/p/1","lastScrap":"2026-01-01T10:00:00Z"}},
+		{"_index":"gopherscrap","_type":"www.shop.com","_id":"p2","_source":{"id":"p2","link":"http://www.shop.com/p/2","lastScrap":"2026-01-02T10:00:00Z"}}
+	]
+ }
+}
+`
+
+// mock recording the query
+type queryMock struct {
+	endpoint string
+	query    interface{}
+}
+
+func (q *queryMock) Do(method string, endpoint string, requestBody interface{}, jsonResponse interface{}) (elasticrest.StatusCode, error) {
+	q.endpoint = endpoint
+	q.query = requestBody
+	err := json.Unmarshal([]byte(staleResponse), jsonResponse)
+	return http.StatusOK, err
+}
+
+func TestStaleItems(t *testing.T) {
+	Convey("The items scraped before a time, the oldest first", t, func() {
+		mock := &queryMock{}
+		ie := &ItemElastic{index: "gopherscrap", handler: NewModelHandler(mock), funcEndpoint: ItemEndpoint}
+
+		before := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+		items, err := ie.StaleItems("www.shop.com", before, 100, 50)
+		So(err, ShouldBeNil)
+		So(mock.endpoint, ShouldEqual, "/gopherscrap/www.shop.com/_search")
+
+		b, _ := json.Marshal(mock.query)
+		So(string(b), ShouldContainSubstring, `"range":{"lastScrap":{"lt":"2026-01-05T00:00:00Z"}}`)
+		So(string(b), ShouldContainSubstring, `"from":100`)
+		So(string(b), ShouldContainSubstring, `"size":50`)
+
+		So(len(items), ShouldEqual, 2)
+		So(items[0].Id, ShouldEqual, "p1")
+		So(items[1].Link, ShouldEqual, "http://www.shop.com/p/2")
+	})
+}
+
+func TestUpdateLastScrap(t *testing.T) {
+	Convey("The unchanged items only update the lastScrap", t, func() {
+		mock := &queryMock{}
+		ie := &ItemElastic{index: "gopherscrap", handler: NewModelHandler(mock), funcEndpointItem: ItemEndpointWithItem}
+
+		_, err := ie.UpdateLastScrap(&model.Item{Id: "p1", Index: "www.shop.com/p1", Title: "Shoe", LastScrap: "2026-01-05T00:00:00Z"})
+		So(err, ShouldBeNil)
+		So(mock.endpoint, ShouldEqual, "/gopherscrap/www.shop.com/p1/_update")
+
+		b, _ := json.Marshal(mock.query)
+		So(string(b), ShouldEqual, `{"doc":{"lastScrap":"2026-01-05T00:00:00Z"}}`)
+	})
+}
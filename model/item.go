@@ -13,9 +13,12 @@ type Item struct {
 	Stars       float64 `json:"starts,omitempty"`
 
 	// metadata
-	ScrapUrl  string `json:"scrapUrl,omitempty"`
-	ScrapTags string `json:"scrapTags,omitempty"`
-	Version   int    `json:"version,omitempty"`
-	Index     string `json:"index,omitempty"`
-	LastScrap string `json:"lastScrap,omitempty"`
+	ScrapUrl     string   `json:"scrapUrl,omitempty"`
+	FinalUrl     string   `json:"finalUrl,omitempty"`
+	Redirects    []string `json:"redirects,omitempty"`
+	CanonicalUrl string   `json:"canonicalUrl,omitempty"`
+	ScrapTags    string   `json:"scrapTags,omitempty"`
+	Version      int      `json:"version,omitempty"`
+	Index        string   `json:"index,omitempty"`
+	LastScrap    string   `json:"lastScrap,omitempty"`
 }
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"errors"
 	"time"
 
 	libredis "github.com/therealbill/libredis/client"
@@ -32,6 +33,37 @@ func NewRedisClient(ip string) *RedisClient {
 	return &RedisClient{client}
 }
 
+// SET with NX and PX in one command, the key is never left without expiration
+func (c *RedisClient) SetNxPx(key string, value string, milliseconds int) (bool, error) {
+	rp, err := c.ExecuteCommand("SET", key, value, "NX", "PX", milliseconds)
+	if err != nil {
+		return false, err
+	}
+	if rp.Type == libredis.ErrorReply {
+		return false, errors.New(rp.Error)
+	}
+	// nil reply when the key already exists
+	return rp.Status == "OK", nil
+}
+
+// EVAL of a script that returns an integer, the script runs atomically in redis
+func (c *RedisClient) EvalInt(script string, keys []string, args ...interface{}) (int64, error) {
+	cmd := []interface{}{"EVAL", script, len(keys)}
+	for _, k := range keys {
+		cmd = append(cmd, k)
+	}
+	cmd = append(cmd, args...)
+
+	rp, err := c.ExecuteCommand(cmd...)
+	if err != nil {
+		return 0, err
+	}
+	if rp.Type == libredis.ErrorReply {
+		return 0, errors.New(rp.Error)
+	}
+	return rp.Integer, nil
+}
+
 func DefaultRedisConfig(ip string) *libredis.DialConfig {
 	return &libredis.DialConfig{
 		Network:  "tcp",
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	esearch "github.com/dahernan/gopherscraper/elasticsearch"
+	"github.com/dahernan/gopherscraper/scraper"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -24,6 +25,8 @@ func (r *ItemsRoute) Get(w http.ResponseWriter, req *http.Request, params httpro
 		HandleHttpErrors(w, err)
 		return
 	}
+	// the popular items are refreshed first
+	scraper.NewRedisScrapdata().ItemViewed(index, itemId)
 
 	Render().JSON(w, http.StatusOK, item)
 }
@@ -43,6 +46,12 @@ func (r *ItemsRoute) MultiGet(w http.ResponseWriter, req *http.Request, params h
 		HandleHttpErrors(w, err)
 		return
 	}
+	rdata := scraper.NewRedisScrapdata()
+	for _, item := range items {
+		if item != nil {
+			rdata.ItemViewed(index, item.Id)
+		}
+	}
 
 	Render().JSON(w, http.StatusOK, items)
 }
@@ -34,6 +34,16 @@ func (e ErrJsonMarshalling) Error() string {
 	return fmt.Sprintf("Error Marshalling JSON body request with message '%v'", e.nested)
 }
 
+// query param that can not be parsed
+type ErrInvalidParam struct {
+	Name  string
+	Value string
+}
+
+func (e ErrInvalidParam) Error() string {
+	return fmt.Sprintf("Invalid value '%s' for the param '%s'", e.Value, e.Name)
+}
+
 func RequestToJsonObject(req *http.Request, jsonDoc interface{}) error {
 	defer req.Body.Close()
 
@@ -61,12 +71,27 @@ func HandleHttpErrors(writer http.ResponseWriter, err error) {
 		return
 	}
 
-	if err == scraper.ErrNoBaseSelector {
+	_, ok = err.(ErrInvalidParam)
+	if ok {
+		Render().JSON(writer, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err == scraper.ErrNoBaseSelector || err == scraper.ErrInvalidSession || err == scraper.ErrInvalidPoliteness ||
+		err == scraper.ErrInvalidHeaderProfile || err == scraper.ErrHeaderProfileUnknown || err == scraper.ErrInvalidUrlRules ||
+		err == scraper.ErrInvalidWarc || err == scraper.ErrUnknownCharset || err == scraper.ErrInvalidSchedule ||
+		err == scraper.ErrInvalidFreshness || err == scraper.ErrInvalidIdFallback {
 		Render().JSON(writer, http.StatusBadRequest, msg)
 		return
 	}
 
-	if err == scraper.ErrJobNotFound {
+	if err == scraper.ErrJobNotRunning || err == scraper.ErrJobNotPaused {
+		Render().JSON(writer, http.StatusConflict, msg)
+		return
+	}
+
+	if err == scraper.ErrJobNotFound || err == scraper.ErrSessionNotFound || err == scraper.ErrCoolDownNotFound ||
+		err == scraper.ErrWarcNotFound || err == scraper.ErrScheduleNotFound || err == scraper.ErrItemNotObserved {
 		Render().JSON(writer, http.StatusNotFound, msg)
 		return
 	}
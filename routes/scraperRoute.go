@@ -2,6 +2,9 @@ package routes
 
 import (
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/yosssi/gohtml"
@@ -41,7 +44,7 @@ func (route *ScraperRoute) Selector(w http.ResponseWriter, r *http.Request, para
 		return
 	}
 
-	Render().JSON(w, http.StatusOK, s)
+	Render().JSON(w, http.StatusOK, s.Redacted())
 
 }
 
@@ -58,7 +61,8 @@ func (route *ScraperRoute) TestURL(w http.ResponseWriter, r *http.Request, param
 
 	scr := scraper.NewScrapper()
 
-	jobId, itemsc, err := scr.Scrap(selector)
+	// a selector being tested does not cool-down the host
+	jobId, itemsc, err := scr.Scrap(scraper.TestScrapContext(r.Context()), selector)
 	if err != nil {
 		HandleHttpErrors(w, err)
 		return
@@ -117,6 +121,62 @@ func (route *ScraperRoute) Scrap(w http.ResponseWriter, r *http.Request, params
 
 }
 
+func (route *ScraperRoute) ReExtract(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var selector scraper.ScrapSelector
+	err := RequestToJsonObject(r, &selector)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	es := scraper.NewElasticReExtractAndStore(route.index)
+	jobId, err := es.ScrapAndStore(selector)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jobId": jobId,
+	}
+
+	Render().JSON(w, http.StatusOK, response)
+
+}
+
+func (route *ScraperRoute) ScrapWarc(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var selector scraper.ScrapSelector
+	err := RequestToJsonObject(r, &selector)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	filename, err := scraper.WarcFile(params.ByName("file"))
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	es, err := scraper.NewElasticWarcAndStore(route.index, filename)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+	jobId, err := es.ScrapAndStore(selector)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jobId": jobId,
+	}
+
+	Render().JSON(w, http.StatusOK, response)
+
+}
+
 func (route *ScraperRoute) StatusJob(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	jobId := params.ByName("id")
 
@@ -131,9 +191,564 @@ func (route *ScraperRoute) StatusJob(w http.ResponseWriter, r *http.Request, par
 
 }
 
+// cancels the running job, it stops with the items scraped until now
+func (route *ScraperRoute) CancelJob(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	jobId := params.ByName("id")
+
+	err := scraper.CancelJob(jobId)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"jobId": jobId, "status": scraper.JobStatusCancelled})
+
+}
+
+// pauses the running job, the pages not scraped yet are kept to resume it
+func (route *ScraperRoute) PauseJob(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	jobId := params.ByName("id")
+
+	err := scraper.PauseJob(jobId)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"jobId": jobId, "status": scraper.JobStatusPaused})
+
+}
+
+// resumes the paused job where it was left, the items are stored in the index
+func (route *ScraperRoute) ResumeJob(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	jobId := params.ByName("id")
+
+	es := scraper.NewElasticScrapAndStore(route.index)
+	err := es.ResumeAndStore(jobId)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"jobId": jobId, "status": scraper.JobStatusRunning})
+
+}
+
+// jobs filtered by host, status, start time and errors, with pagination
+func (route *ScraperRoute) Jobs(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	filter, err := jobFilter(r.URL.Query())
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	data := scraper.NewRedisScrapdata()
+	jobs, err := data.Jobs(filter)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, jobs)
+
+}
+
+func jobFilter(q url.Values) (scraper.JobFilter, error) {
+	var err error
+	filter := scraper.JobFilter{
+		Host:   q.Get("host"),
+		Status: q.Get("status"),
+	}
+
+	filter.StartedAfter, err = timeParam(q, "after")
+	if err != nil {
+		return filter, err
+	}
+	filter.StartedBefore, err = timeParam(q, "before")
+	if err != nil {
+		return filter, err
+	}
+
+	if v := q.Get("errors"); v != "" {
+		hasErrors, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, ErrInvalidParam{"errors", v}
+		}
+		filter.HasErrors = &hasErrors
+	}
+
+	filter.Offset, err = intParam(q, "offset")
+	if err != nil {
+		return filter, err
+	}
+	filter.Limit, err = intParam(q, "limit")
+	return filter, err
+}
+
+// unix seconds or RFC3339
+func timeParam(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return t, ErrInvalidParam{name, v}
+	}
+	return t, nil
+}
+
+func intParam(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, ErrInvalidParam{name, v}
+	}
+	return n, nil
+}
+
+// recent jobs of the url, the expired ones are skipped
+func (route *ScraperRoute) Runs(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	scrapUrl := r.URL.Query().Get("url")
+
+	data := scraper.NewRedisScrapdata()
+	jobIds, err := data.JobRuns(scrapUrl)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	runs := []map[string]interface{}{}
+	for _, jobId := range jobIds {
+		job, err := data.ScrapJob(jobId)
+		if err == scraper.ErrJobNotFound {
+			continue
+		}
+		if err != nil {
+			HandleHttpErrors(w, err)
+			return
+		}
+		runs = append(runs, map[string]interface{}{"jobId": jobId, "meta": job["meta"]})
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"url": scrapUrl, "runs": runs})
+
+}
+
+func (route *ScraperRoute) SaveSession(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var session scraper.SessionSpec
+	err := RequestToJsonObject(r, &session)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	err = rdata.SaveSession(session)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, session.Redacted())
+
+}
+
+func (route *ScraperRoute) Session(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	session, err := rdata.Session(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, session.Redacted())
+
+}
+
+func (route *ScraperRoute) DeleteSession(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteSession(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+func (route *ScraperRoute) SavePoliteness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var politeness scraper.Politeness
+	err := RequestToJsonObject(r, &politeness)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	err = rdata.SaveHostPoliteness(politeness)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, politeness)
+
+}
+
+func (route *ScraperRoute) Politeness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	politeness, err := rdata.HostPoliteness(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, politeness)
+
+}
+
+func (route *ScraperRoute) DeletePoliteness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteHostPoliteness(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+func (route *ScraperRoute) Profiles(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	Render().JSON(w, http.StatusOK, scraper.HeaderProfiles())
+
+}
+
+func (route *ScraperRoute) SaveProfile(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var profile scraper.HostProfile
+	err := RequestToJsonObject(r, &profile)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	err = rdata.SaveHostProfile(profile)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, profile)
+
+}
+
+func (route *ScraperRoute) Profile(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	profile, err := rdata.HostProfile(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, scraper.HostProfile{Host: host, Profile: profile})
+
+}
+
+func (route *ScraperRoute) DeleteProfile(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteHostProfile(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+func (route *ScraperRoute) SaveUrlRules(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var rules scraper.UrlRules
+	err := RequestToJsonObject(r, &rules)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	err = rdata.SaveHostUrlRules(rules)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, rules)
+
+}
+
+func (route *ScraperRoute) UrlRules(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	rules, err := rdata.HostUrlRules(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, rules)
+
+}
+
+func (route *ScraperRoute) DeleteUrlRules(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteHostUrlRules(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+// saves the schedule, its next run is calculated
+func (route *ScraperRoute) SaveSchedule(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var schedule scraper.Schedule
+	err := RequestToJsonObject(r, &schedule)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	schedule, err = rdata.SaveSchedule(schedule)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, schedule)
+
+}
+
+// the schedules with their last and next run
+func (route *ScraperRoute) Schedules(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	rdata := scraper.NewRedisScrapdata()
+	schedules, err := rdata.Schedules()
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, schedules)
+
+}
+
+func (route *ScraperRoute) Schedule(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	id := params.ByName("id")
+
+	rdata := scraper.NewRedisScrapdata()
+	schedule, err := rdata.Schedule(id)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, schedule)
+
+}
+
+func (route *ScraperRoute) DeleteSchedule(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	id := params.ByName("id")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteSchedule(id)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"id": id})
+
+}
+
+func (route *ScraperRoute) SaveFreshness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	var freshness scraper.Freshness
+	err := RequestToJsonObject(r, &freshness)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	rdata := scraper.NewRedisScrapdata()
+	err = rdata.SaveHostFreshness(freshness)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, freshness)
+
+}
+
+func (route *ScraperRoute) Freshness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	freshness, err := rdata.HostFreshness(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, freshness)
+
+}
+
+func (route *ScraperRoute) DeleteFreshness(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.DeleteHostFreshness(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+// change rate learned for the item, with the time it is due
+func (route *ScraperRoute) ItemChanges(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+	id := params.ByName("id")
+
+	rdata := scraper.NewRedisScrapdata()
+	changes, err := rdata.ItemChanges(host, id)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, changes)
+
+}
+
+// scraps again the stale items now, up to the budget of pages
+func (route *ScraperRoute) Refresh(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	budget, err := intParam(r.URL.Query(), "budget")
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+	if budget == 0 {
+		budget = scraper.RefreshBudget()
+	}
+
+	refresher := scraper.NewRefresher(route.index, scraper.NewElasticScrapAndStore(route.index))
+	result, err := refresher.Refresh(time.Now(), budget)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, result)
+
+}
+
+func (route *ScraperRoute) CoolDowns(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	rdata := scraper.NewRedisScrapdata()
+	coolDowns, err := rdata.CoolDowns()
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, coolDowns)
+
+}
+
+func (route *ScraperRoute) CoolDown(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	coolDown, err := rdata.CoolDown(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, coolDown)
+
+}
+
+func (route *ScraperRoute) ClearCoolDown(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	host := params.ByName("host")
+
+	rdata := scraper.NewRedisScrapdata()
+	err := rdata.ClearCoolDown(host)
+	if err != nil {
+		HandleHttpErrors(w, err)
+		return
+	}
+
+	Render().JSON(w, http.StatusOK, map[string]interface{}{"host": host})
+
+}
+
+func (route *ScraperRoute) Proxies(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	rdata := scraper.NewRedisScrapdata()
+
+	pools := map[string]interface{}{}
+	for _, pool := range scraper.ProxyPools() {
+		var proxies []scraper.ProxyHealth
+		for _, p := range pool.Proxies() {
+			proxies = append(proxies, rdata.ProxyHealth(p))
+		}
+		pools[pool.Name] = map[string]interface{}{
+			"sticky":  pool.Sticky,
+			"proxies": proxies,
+		}
+	}
+
+	Render().JSON(w, http.StatusOK, pools)
+
+}
+
 func (route *ScraperRoute) Log(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	data := scraper.NewRedisScrapdata()
 	resp := data.ScrapLog()
 	Render().JSON(w, http.StatusOK, resp)
 
 }
+
+func (route *ScraperRoute) Audit(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+	data := scraper.NewRedisScrapdata()
+	resp := data.AuditLog()
+	Render().JSON(w, http.StatusOK, resp)
+
+}
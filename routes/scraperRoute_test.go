@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	elastic "github.com/dahernan/gopherscraper/elasticsearch"
@@ -133,3 +134,26 @@ func (r *RequestMock) Do(method string, endpoint string, requestBody interface{}
 	}
 	return http.StatusOK, nil
 }
+
+func TestJobsFilterParams(t *testing.T) {
+	Convey("The jobs are filtered by the query params", t, func() {
+		q := url.Values{}
+		q.Set("host", "www.amazon.co.uk")
+		q.Set("after", "2014-11-27T17:30:52Z")
+		q.Set("before", "1417109943")
+		q.Set("errors", "true")
+		q.Set("limit", "5")
+
+		filter, err := jobFilter(q)
+		So(err, ShouldBeNil)
+		So(filter.Host, ShouldEqual, "www.amazon.co.uk")
+		So(filter.StartedAfter.Unix(), ShouldEqual, 1417109452)
+		So(filter.StartedBefore.Unix(), ShouldEqual, 1417109943)
+		So(*filter.HasErrors, ShouldBeTrue)
+		So(filter.Limit, ShouldEqual, 5)
+
+		q.Set("after", "yesterday")
+		_, err = jobFilter(q)
+		So(err, ShouldResemble, ErrInvalidParam{"after", "yesterday"})
+	})
+}
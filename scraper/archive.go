@@ -0,0 +1,257 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"log"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	FetchErrorArchive = "archive"
+
+	// sortable fetch time in the archive keys
+	archiveTimeFormat = "20060102T150405.000000000Z"
+)
+
+var (
+	ErrArchiveNotFound = fmt.Errorf("Page not found in the archive")
+
+	// where the fetched pages are archived, nil does not archive
+	pageArchive PageArchive
+)
+
+// Store for the raw pages, a local directory or a S3 compatible bucket
+type PageArchive interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	// keys starting with the prefix
+	List(prefix string) ([]string, error)
+}
+
+// Page as it was fetched
+type ArchivedPage struct {
+	Url     string
+	Fetched time.Time
+	Body    []byte
+}
+
+// archive every fetched page
+func UsePageArchive(a PageArchive) {
+	pageArchive = a
+}
+
+// <host>/<page id>/<fetch time>.html.gz, the page id tells apart
+// the pages of the same url with a different request body
+func archivePrefix(selector ScrapSelector) string {
+	host := "unknown"
+	u, err := neturl.Parse(selector.Url)
+	if err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(selector.Url))
+	body, _ := selector.Request.body()
+	if body != nil {
+		b, _ := ioutil.ReadAll(body)
+		h.Write(b)
+	}
+	return fmt.Sprintf("%s/%x/", host, h.Sum64())
+}
+
+// compressed page with the url and the fetch time in the gzip header
+func archivePage(selector ScrapSelector, fetched time.Time, body []byte) error {
+	if pageArchive == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Comment = selector.Url
+	gz.ModTime = fetched
+	_, err := gz.Write(body)
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	key := archivePrefix(selector) + fetched.UTC().Format(archiveTimeFormat) + ".html.gz"
+	return pageArchive.Put(key, buf.Bytes())
+}
+
+// the last archived copy of the page of the selector
+func LatestArchivedPage(selector ScrapSelector) (*ArchivedPage, error) {
+	if pageArchive == nil {
+		return nil, ErrArchiveNotFound
+	}
+
+	keys, err := pageArchive.List(archivePrefix(selector))
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrArchiveNotFound
+	}
+	sort.Strings(keys)
+
+	data, err := pageArchive.Get(keys[len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	body, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchivedPage{Url: gz.Comment, Fetched: gz.ModTime, Body: body}, nil
+}
+
+// Archive in a local directory
+type DirArchive struct {
+	Dir string
+}
+
+func NewDirArchive(dir string) PageArchive {
+	return DirArchive{Dir: dir}
+}
+
+func (a DirArchive) Put(key string, data []byte) error {
+	filename := filepath.Join(a.Dir, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+func (a DirArchive) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(filepath.Join(a.Dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrArchiveNotFound
+	}
+	return data, err
+}
+
+func (a DirArchive) List(prefix string) ([]string, error) {
+	// the prefixes always end in a directory
+	dir := filepath.Join(a.Dir, filepath.FromSlash(prefix))
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".gz") {
+			keys = append(keys, prefix+f.Name())
+		}
+	}
+	return keys, nil
+}
+
+// Scraps pages without network access, from the archive or a WARC file
+type OfflineScrapper struct {
+	// prefix of the job ids
+	source   string
+	document func(selector ScrapSelector) (*fetchedPage, error)
+}
+
+// Scraps the archived pages, useful to re-extract the items after fixing a selector
+func NewArchiveScrapper() ScrapperItems {
+	return OfflineScrapper{source: "A", document: archivedDocument}
+}
+
+func (o OfflineScrapper) Scrap(ctx context.Context, selector ScrapSelector) (string, chan ItemResult, error) {
+	wg := &sync.WaitGroup{}
+	err := validateSelector(selector)
+	if err != nil {
+		return "", nil, err
+	}
+
+	items := make(chan ItemResult, bufferItemsSize)
+
+	ctx, jobId, started := scrapJob(ctx, o.source, selector)
+	if started {
+		log.Printf("INFO: Scrap [%s] offline started\n", jobId)
+	}
+
+	pages := paginatedUrlSelector(selector)
+
+	wg.Add(len(pages))
+	for i, _ := range pages {
+		go o.doScrap(ctx, jobId, pages[i], items, wg)
+	}
+
+	if started {
+		go closeItemsChannel(ctx, jobId, items, wg)
+	} else {
+		go closePageItems(items, wg)
+	}
+
+	return jobId, items, nil
+}
+
+func (o OfflineScrapper) doScrap(ctx context.Context, jobId string, s ScrapSelector, items chan ItemResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if ctx.Err() != nil {
+		return
+	}
+	data := NewRedisScrapdata()
+
+	page, err := o.document(s)
+	if err != nil {
+		log.Printf("ERROR [%s] Scrapping %v offline with message %v", jobId, s.Url, err.Error())
+		data.JobPage(jobId, s, 1, "", err)
+		data.JobError(jobId, err)
+		return
+	}
+	data.JobPage(jobId, s, 1, page.charset, nil)
+	documentScrap(ctx, jobId, s, page, items)
+}
+
+func archivedDocument(selector ScrapSelector) (*fetchedPage, error) {
+	archived, err := LatestArchivedPage(selector)
+	if err == ErrArchiveNotFound {
+		return nil, FetchError{Kind: FetchErrorArchive, Url: selector.Url, Msg: "page not archived"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// without headers the charset comes from the page
+	body, charset, err := decodeCharset(selector, archived.Body, "")
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	doc.Url, _ = neturl.Parse(archived.Url)
+	return &fetchedPage{Document: doc, charset: charset}, nil
+}
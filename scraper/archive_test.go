@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// minimal S3 compatible server keeping the objects in memory
+func newFakeS3() (*httptest.Server, *sync.Map) {
+	objects := &sync.Map{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/pages/")
+
+		switch {
+		case r.Method == "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			objects.Store(key, b)
+		case r.URL.Query().Get("list-type") == "2":
+			var list s3ListResult
+			objects.Range(func(k, v interface{}) bool {
+				if strings.HasPrefix(k.(string), r.URL.Query().Get("prefix")) {
+					list.Contents = append(list.Contents, struct {
+						Key string `xml:"Key"`
+					}{k.(string)})
+				}
+				return true
+			})
+			xml.NewEncoder(w).Encode(list)
+		default:
+			b, ok := objects.Load(key)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(b.([]byte))
+		}
+	}))
+	return ts, objects
+}
+
+func TestPageArchive(t *testing.T) {
+	Convey("Fetched pages are archived and can be scraped again offline", t, func() {
+		page := example1
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(page))
+		}))
+		defer ts.Close()
+
+		dir, err := ioutil.TempDir("", "archive")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		s3, objects := newFakeS3()
+		defer s3.Close()
+
+		archives := []struct {
+			name    string
+			archive PageArchive
+		}{
+			{"local directory", NewDirArchive(dir)},
+			{"S3 bucket", NewS3Archive(s3.URL, "pages", "", "key", "secret")},
+		}
+		defer UsePageArchive(nil)
+
+		for _, a := range archives {
+			archive := a.archive
+			Convey("in a "+a.name, func() {
+				UsePageArchive(archive)
+
+				s := ScrapSelector{
+					Url:   ts.URL + "/list.html",
+					Base:  ".product-info",
+					Title: Selector{Exp: "h2"},
+				}
+				_, err := SnippetBase(s)
+				So(err, ShouldBeNil)
+
+				archived, err := LatestArchivedPage(s)
+				So(err, ShouldBeNil)
+				So(archived.Url, ShouldEqual, s.Url)
+				So(string(archived.Body), ShouldEqual, example1)
+
+				Convey("the latest copy is used", func() {
+					page = strings.Replace(example1, "Test2", "Test3", -1)
+					_, err := SnippetBase(s)
+					So(err, ShouldBeNil)
+
+					archived, err := LatestArchivedPage(s)
+					So(err, ShouldBeNil)
+					So(string(archived.Body), ShouldContainSubstring, "Test3")
+				})
+
+				Convey("re-extract with a new selector without network", func() {
+					ts.Close()
+					s.Title = Selector{Exp: "h2", Attr: "id"}
+
+					_, items, err := NewArchiveScrapper().Scrap(context.Background(), s)
+					So(err, ShouldBeNil)
+
+					var titles []string
+					for it := range items {
+						titles = append(titles, it.Item.Title)
+					}
+					So(titles, ShouldContain, "123")
+					So(titles, ShouldContain, "124")
+				})
+
+				Convey("pages not archived fail", func() {
+					s.Url = ts.URL + "/other.html"
+					_, err := archivedDocument(s)
+					So(fetchErrorKind(err), ShouldEqual, FetchErrorArchive)
+				})
+			})
+		}
+
+		Convey("the S3 requests carry the access key", func() {
+			UsePageArchive(NewS3Archive(s3.URL, "pages", "", "other", "secret"))
+			err := archivePage(ScrapSelector{Url: ts.URL}, time.Now(), []byte(example1))
+			So(err, ShouldNotBeNil)
+			count := 0
+			objects.Range(func(k, v interface{}) bool { count++; return true })
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
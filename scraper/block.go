@@ -0,0 +1,203 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	FetchErrorBlocked  = "blocked"
+	FetchErrorCoolDown = "coolDown"
+)
+
+var (
+	ErrCoolDownNotFound = fmt.Errorf("Host is not in cool-down")
+
+	defaultBlockDetection BlockDetection
+)
+
+func init() {
+	UseBlockDetection(BlockDetection{
+		BlockStatus:     []int{403, 429},
+		StatusThreshold: 3,
+		ZeroMatchPages:  5,
+		CoolDownSeconds: 15 * 60,
+	})
+}
+
+// How to detect that a host is blocking the scraper
+type BlockDetection struct {
+	// consecutive responses with a block status to cool-down the host
+	BlockStatus     []int `json:"blockStatus,omitempty"`
+	StatusThreshold int   `json:"statusThreshold,omitempty"`
+	// captcha or "unusual traffic" pages, one is enough to cool-down the host
+	Markers []Marker `json:"markers,omitempty"`
+	// consecutive pages without Base matches, on a host that had matches before
+	ZeroMatchPages int `json:"zeroMatchPages,omitempty"`
+
+	CoolDownSeconds int `json:"coolDownSeconds,omitempty"`
+}
+
+// Host paused for all the jobs
+type CoolDown struct {
+	Host   string    `json:"host"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+}
+
+// default block detection for all the selectors
+func UseBlockDetection(b BlockDetection) {
+	defaultBlockDetection = b
+}
+
+func blockDetectionFor(selector ScrapSelector) BlockDetection {
+	if selector.Block == nil {
+		return defaultBlockDetection
+	}
+
+	b := *selector.Block
+	if b.BlockStatus == nil {
+		b.BlockStatus = defaultBlockDetection.BlockStatus
+	}
+	if b.StatusThreshold <= 0 {
+		b.StatusThreshold = defaultBlockDetection.StatusThreshold
+	}
+	if b.Markers == nil {
+		b.Markers = defaultBlockDetection.Markers
+	}
+	if b.ZeroMatchPages <= 0 {
+		b.ZeroMatchPages = defaultBlockDetection.ZeroMatchPages
+	}
+	if b.CoolDownSeconds <= 0 {
+		b.CoolDownSeconds = defaultBlockDetection.CoolDownSeconds
+	}
+	return b
+}
+
+func (b BlockDetection) blockStatus(status int) bool {
+	for _, s := range b.BlockStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// a block page found by the markers
+func (b BlockDetection) blockedDocument(pageUrl string, status int, doc *goquery.Document, body []byte) error {
+	for _, m := range b.Markers {
+		if m.found(doc, body) {
+			return FetchError{Kind: FetchErrorBlocked, Url: pageUrl, StatusCode: status, Msg: "block page found by " + m.String()}
+		}
+	}
+	return nil
+}
+
+// fails when the host of the selector is in cool-down,
+// the error asks to retry after the cool-down
+func checkCoolDown(selector ScrapSelector) error {
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return err
+	}
+
+	c, err := NewRedisScrapdata().CoolDown(u.Host)
+	if err == ErrCoolDownNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return FetchError{
+		Kind:       FetchErrorCoolDown,
+		Url:        selector.Url,
+		Msg:        "host in cool-down: " + c.Reason,
+		RetryAfter: c.Until.Sub(time.Now()),
+	}
+}
+
+// records the response of the host and cools it down when it looks blocked
+func detectBlock(selector ScrapSelector, err error) {
+	u, perr := neturl.Parse(selector.Url)
+	if perr != nil {
+		return
+	}
+
+	b := blockDetectionFor(selector)
+	rdata := NewRedisScrapdata()
+
+	fe, ok := err.(FetchError)
+	switch {
+	case ok && fe.Kind == FetchErrorBlocked:
+		coolDown(u.Host, b, fe.Msg)
+	case ok && fe.Kind == FetchErrorStatus && b.blockStatus(fe.StatusCode):
+		signals := rdata.BlockSignal(u.Host, "status")
+		if signals >= int64(b.StatusThreshold) {
+			coolDown(u.Host, b, fmt.Sprintf("%v consecutive responses with status %v", signals, fe.StatusCode))
+		}
+	case err == nil:
+		rdata.ResetBlockSignal(u.Host, "status")
+	}
+}
+
+type testScrapKey struct{}
+
+// context of a scrap testing a selector, its pages are not signals for the block detection
+func TestScrapContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, testScrapKey{}, true)
+}
+
+func testScrap(ctx context.Context) bool {
+	test, _ := ctx.Value(testScrapKey{}).(bool)
+	return test
+}
+
+// records the Base matches of a page, many pages of a selector without matches
+// cool-down the host, only when the same selector had matches before
+func detectZeroMatches(selector ScrapSelector, matches int) {
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return
+	}
+
+	b := blockDetectionFor(selector)
+	rdata := NewRedisScrapdata()
+	// the profile and the proxy of the selector change between fetches
+	zero := "zero:" + extractionFingerprint(selector)
+
+	if matches > 0 {
+		rdata.ResetBlockSignal(u.Host, zero)
+		rdata.BlockSignalMatched(u.Host, selector)
+		return
+	}
+
+	signals := rdata.BlockSignal(u.Host, zero)
+	if signals >= int64(b.ZeroMatchPages) && rdata.BlockSignalHasMatched(u.Host, selector) {
+		coolDown(u.Host, b, fmt.Sprintf("%v consecutive pages without matches for %s", signals, selector.Base))
+	}
+}
+
+func coolDown(host string, b BlockDetection, reason string) {
+	now := time.Now()
+	c := CoolDown{
+		Host:   host,
+		Reason: reason,
+		Since:  now,
+		Until:  now.Add(time.Duration(b.CoolDownSeconds) * time.Second),
+	}
+
+	log.Printf("ERROR: Host %s looks blocked, cool-down until %v: %s", host, c.Until.Format(time.RFC3339), reason)
+	rdata := NewRedisScrapdata()
+	err := rdata.SaveCoolDown(c)
+	if err != nil {
+		log.Printf("ERROR: Host %s can not save the cool-down %v", host, err.Error())
+	}
+	rdata.ScrapLogWrite(fmt.Sprintf("WARN: %s in cool-down until %s: %s", host, c.Until.Format(time.RFC3339), reason))
+}
@@ -0,0 +1,128 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlockDetection(t *testing.T) {
+	Convey("Hosts that block the scraper are put in cool-down", t, func() {
+		status := http.StatusOK
+		page := example1
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(page))
+		}))
+		defer ts.Close()
+
+		u, _ := neturl.Parse(ts.URL)
+		rdata := NewRedisScrapdata()
+		defer rdata.ClearCoolDown(u.Host)
+
+		s := ScrapSelector{
+			Url:   ts.URL + "/list.html",
+			Base:  ".product-info",
+			Retry: &RetryPolicy{MaxAttempts: 1},
+			Block: &BlockDetection{
+				StatusThreshold: 2,
+				ZeroMatchPages:  2,
+				Markers:         []Marker{{Text: "unusual traffic"}},
+			},
+		}
+
+		Convey("captcha page", func() {
+			page = `<html><body>We have detected unusual traffic from your network</body></html>`
+
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorBlocked)
+
+			c, err := rdata.CoolDown(u.Host)
+			So(err, ShouldBeNil)
+			So(c.Reason, ShouldContainSubstring, "unusual traffic")
+
+			Convey("pauses the fetches until it is cleared", func() {
+				page = example1
+				_, err := SnippetBase(s)
+				So(fetchErrorKind(err), ShouldEqual, FetchErrorCoolDown)
+
+				err = rdata.ClearCoolDown(u.Host)
+				So(err, ShouldBeNil)
+
+				_, err = SnippetBase(s)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("consecutive block status", func() {
+			status = http.StatusForbidden
+
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorStatus)
+			_, err = rdata.CoolDown(u.Host)
+			So(err, ShouldEqual, ErrCoolDownNotFound)
+
+			_, err = SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorStatus)
+			_, err = rdata.CoolDown(u.Host)
+			So(err, ShouldBeNil)
+
+			coolDowns, err := rdata.CoolDowns()
+			So(err, ShouldBeNil)
+			So(len(coolDowns), ShouldBeGreaterThan, 0)
+		})
+
+		Convey("sudden pages without matches", func() {
+			_, items, _ := NewScrapper().Scrap(context.Background(), s)
+			for _ = range items {
+			}
+
+			page = `<html><body>nothing here</body></html>`
+			for i := 0; i < 2; i++ {
+				_, items, _ = NewScrapper().Scrap(context.Background(), s)
+				for _ = range items {
+				}
+			}
+
+			c, err := rdata.CoolDown(u.Host)
+			So(err, ShouldBeNil)
+			So(c.Reason, ShouldContainSubstring, "without matches")
+		})
+
+		Convey("pages without matches of other selectors or tests", func() {
+			_, items, _ := NewScrapper().Scrap(context.Background(), s)
+			for _ = range items {
+			}
+
+			other := s
+			other.Base = ".mistyped"
+			invalid := s
+			invalid.Base = "div[["
+			for i := 0; i < 3; i++ {
+				for _, sel := range []ScrapSelector{other, invalid} {
+					_, items, _ = NewScrapper().Scrap(context.Background(), sel)
+					for _ = range items {
+					}
+				}
+			}
+			page = `<html><body>nothing here</body></html>`
+			for i := 0; i < 3; i++ {
+				_, items, _ = NewScrapper().Scrap(TestScrapContext(context.Background()), s)
+				for _ = range items {
+				}
+			}
+
+			_, err := rdata.CoolDown(u.Host)
+			So(err, ShouldEqual, ErrCoolDownNotFound)
+		})
+	})
+}
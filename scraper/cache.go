@@ -0,0 +1,201 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+var (
+	// seconds to keep the cached pages, 0 disables the cache
+	httpCacheTTL int
+)
+
+// set how long the pages are cached to revalidate them with conditional requests
+func UseHttpCache(ttl int) {
+	httpCacheTTL = ttl
+}
+
+// Copy of a page with the validators to revalidate it
+type CacheEntry struct {
+	Url          string
+	ETag         string
+	LastModified string
+	ContentType  string
+	Body         []byte
+	// fingerprint of the extraction of the selector that scraped the page
+	Selector string
+	Fetched  time.Time
+}
+
+// Document fetched, with the cache status and the redirects
+type fetchedPage struct {
+	*goquery.Document
+	// cacheHit, cacheMiss or empty when the page is not cacheable
+	cache string
+	// the page and the selector did not change since the last scrap
+	unchanged bool
+	// charset of the page before the transcoding to UTF-8
+	charset string
+	// url of the page after the redirects, and the urls redirected
+	finalUrl  string
+	redirects []string
+	// the Base matches of the page are signals for the block detection
+	detectBlocks bool
+}
+
+// only simple GET requests are cached, the pages of a session are not
+func cacheable(selector ScrapSelector) bool {
+	return httpCacheTTL > 0 && !selector.NoCache && selector.Request.method() == "GET" && !selector.Request.hasBody()
+}
+
+func selectorFingerprint(selector ScrapSelector) string {
+	b, _ := json.Marshal(selector)
+	h := fnv.New64a()
+	h.Write(b)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// the cached copy of the page for the headers and the cookies of the request,
+// the variants of the same url (country, currency) are cached apart
+func cacheKey(selector ScrapSelector) string {
+	spec := selector.Request
+	if len(spec.Headers) == 0 && len(spec.Cookies) == 0 {
+		return selector.Url
+	}
+	b, _ := json.Marshal([]interface{}{spec.Headers, spec.Cookies})
+	h := fnv.New64a()
+	h.Write(b)
+	return fmt.Sprintf("%s#%x", selector.Url, h.Sum64())
+}
+
+// fingerprint of the fields that build the items from the page, with the request
+// of the variant of the page. The profile, the proxy and the fetch policies can
+// change between fetches of the same page
+func extractionFingerprint(s ScrapSelector) string {
+	b, _ := json.Marshal([]interface{}{
+		s.Url, s.Request, s.Base, s.Stype, s.Recursive,
+		s.IdFrom, s.IdPrefix, s.IdExtractor, s.Id, s.IdFallback, s.IdFallbackFields,
+		s.Link, s.LinkPathLimit, s.Image, s.Title, s.Description, s.Price, s.Categories, s.Stars,
+		s.ScrapTags, s.Charset, s.Redirect,
+	})
+	h := fnv.New64a()
+	h.Write(b)
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// conditional headers to revalidate the cached page
+func (c CacheEntry) setValidators(req *http.Request) {
+	if c.ETag != "" {
+		req.Header.Set("If-None-Match", c.ETag)
+	}
+	if c.LastModified != "" {
+		req.Header.Set("If-Modified-Since", c.LastModified)
+	}
+}
+
+// response built from the cached page, for a 304 Not Modified
+func (c CacheEntry) response(notModified *http.Response) *http.Response {
+	notModified.Body.Close()
+
+	header := http.Header{}
+	header.Set("Content-Type", c.ContentType)
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       notModified.Request,
+	}
+}
+
+// fetches the page revalidating the cached copy
+func fetchCached(selector ScrapSelector, client *http.Client, req *http.Request) (*fetchedPage, error) {
+	rdata := NewRedisScrapdata()
+	key := cacheKey(selector)
+	entry, found, err := rdata.HttpCache(key)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		entry.setValidators(req)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := cacheMiss
+	if found && res.StatusCode == http.StatusNotModified {
+		res = entry.response(res)
+		cache = cacheHit
+	}
+
+	page, body, err := pageFromResponse(selector, res)
+	if err != nil {
+		return nil, err
+	}
+	page.cache = cache
+
+	fingerprint := extractionFingerprint(selector)
+	if page.cache == cacheHit {
+		page.unchanged = entry.Selector == fingerprint
+	}
+
+	etag := res.Header.Get("ETag")
+	lastModified := res.Header.Get("Last-Modified")
+	if page.cache == cacheHit {
+		etag, lastModified = entry.ETag, entry.LastModified
+	}
+	if etag == "" && lastModified == "" {
+		return page, nil
+	}
+
+	err = rdata.SaveHttpCache(key, CacheEntry{
+		Url:          selector.Url,
+		ETag:         etag,
+		LastModified: lastModified,
+		ContentType:  res.Header.Get("Content-Type"),
+		Body:         body,
+		Selector:     fingerprint,
+		Fetched:      time.Now(),
+	}, httpCacheTTL)
+	return page, err
+}
+
+func gzipBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(b)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	return buf.Bytes(), err
+}
+
+func gunzipBytes(b []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
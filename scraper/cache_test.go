@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHttpCache(t *testing.T) {
+	Convey("Pages are revalidated with conditional requests", t, func() {
+		UseHttpCache(60 * 60)
+		defer UseHttpCache(0)
+
+		var downloads, notModified int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(&downloads, 1)
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:   ts.URL + "/list.html",
+			Base:  ".product-info",
+			Title: Selector{Exp: "h2"},
+		}
+
+		scrap := func(s ScrapSelector) (map[string]string, []ItemResult) {
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			var results []ItemResult
+			for it := range items {
+				results = append(results, it)
+			}
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			return job["meta"].(map[string]string), results
+		}
+
+		meta, results := scrap(s)
+		So(meta["cache:miss"], ShouldEqual, "1")
+		So(len(results), ShouldEqual, 2)
+		So(results[0].Unchanged, ShouldBeFalse)
+
+		Convey("a not modified page re-uses the cached body", func() {
+			meta, results := scrap(s)
+			So(meta["cache:hit"], ShouldEqual, "1")
+			So(meta["cache:miss"], ShouldEqual, "")
+			So(atomic.LoadInt32(&downloads), ShouldEqual, 1)
+			So(atomic.LoadInt32(&notModified), ShouldEqual, 1)
+
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Item.Title, ShouldEqual, "Test")
+			So(results[0].Unchanged, ShouldBeTrue)
+		})
+
+		Convey("the items are not unchanged if the selector changed", func() {
+			s.Title = Selector{Exp: "h2 a"}
+			_, results := scrap(s)
+			So(atomic.LoadInt32(&notModified), ShouldEqual, 1)
+			So(results[0].Unchanged, ShouldBeFalse)
+
+			Convey("and the next scrap with the new selector is unchanged", func() {
+				_, results := scrap(s)
+				So(results[0].Unchanged, ShouldBeTrue)
+			})
+		})
+
+		Convey("the items are unchanged with another header profile", func() {
+			s.Profile = "firefox"
+			_, results := scrap(s)
+			So(atomic.LoadInt32(&notModified), ShouldEqual, 1)
+			So(results[0].Unchanged, ShouldBeTrue)
+		})
+
+		Convey("the variants of the request are cached apart", func() {
+			s.Request = RequestSpec{Cookies: map[string]string{"currency": "EUR"}}
+			_, results := scrap(s)
+			So(atomic.LoadInt32(&notModified), ShouldEqual, 0)
+			So(atomic.LoadInt32(&downloads), ShouldEqual, 2)
+			So(results[0].Unchanged, ShouldBeFalse)
+
+			_, results = scrap(s)
+			So(atomic.LoadInt32(&notModified), ShouldEqual, 1)
+			So(results[0].Unchanged, ShouldBeTrue)
+		})
+
+		Convey("noCache downloads the page", func() {
+			s.NoCache = true
+			scrap(s)
+			So(atomic.LoadInt32(&downloads), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	// runs of the jobs in this process, a resumed job can start a run while
+	// the paused one is still stopping
+	runningJobs   = map[string]map[uint64]jobRun{}
+	runningJobsMu sync.Mutex
+	lastJobRun    uint64
+)
+
+type jobRootKey struct{}
+type jobRunKey struct{}
+
+type jobRun struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+}
+
+// context of the job, done when the job is cancelled, paused or the parent is done.
+// The first job of the context is the root, the children jobs keep their pending
+// pages in the root job
+func jobContext(parent context.Context, jobId string) context.Context {
+	if jobRoot(parent) == "" {
+		parent = context.WithValue(parent, jobRootKey{}, jobId)
+	}
+	ctx, cancel := context.WithCancelCause(parent)
+
+	runningJobsMu.Lock()
+	lastJobRun++
+	run := lastJobRun
+	ctx = context.WithValue(ctx, jobRunKey{}, run)
+	if runningJobs[jobId] == nil {
+		runningJobs[jobId] = map[uint64]jobRun{}
+	}
+	runningJobs[jobId][run] = jobRun{ctx: ctx, cancel: cancel}
+	runningJobsMu.Unlock()
+
+	return ctx
+}
+
+// the context of the last run of the job in this process, done when the job
+// stops. A job not running here has the background context
+func runContext(jobId string) context.Context {
+	runningJobsMu.Lock()
+	defer runningJobsMu.Unlock()
+
+	var last uint64
+	ctx := context.Background()
+	for run, r := range runningJobs[jobId] {
+		if run > last {
+			last = run
+			ctx = r.ctx
+		}
+	}
+	return ctx
+}
+
+// the job of a scrap, it starts a new one unless the context is already in a job,
+// then the pages are recorded in that one, the detail pages of a recursive job do
+// not start jobs. It tells if the job was started
+func scrapJob(ctx context.Context, source string, selector ScrapSelector) (context.Context, string, bool) {
+	if root := jobRoot(ctx); root != "" {
+		return ctx, root, false
+	}
+	jobId := NewJobId(source)
+	NewRedisScrapdata().StartJob(jobId, selector)
+	return jobContext(ctx, jobId), jobId, true
+}
+
+// the job started by the API, the one that can be paused and resumed
+func jobRoot(ctx context.Context) string {
+	root, _ := ctx.Value(jobRootKey{}).(string)
+	return root
+}
+
+// the run of the job with the context finished, its context is released
+func releaseJob(ctx context.Context, jobId string) {
+	run, _ := ctx.Value(jobRunKey{}).(uint64)
+
+	runningJobsMu.Lock()
+	r, ok := runningJobs[jobId][run]
+	delete(runningJobs[jobId], run)
+	if len(runningJobs[jobId]) == 0 {
+		delete(runningJobs, jobId)
+	}
+	runningJobsMu.Unlock()
+
+	if ok {
+		r.cancel(nil)
+	}
+}
+
+// stops the runs of the job in this process, the cause tells why
+func stopJob(jobId string, cause error) {
+	runningJobsMu.Lock()
+	var cancels []context.CancelCauseFunc
+	for _, r := range runningJobs[jobId] {
+		cancels = append(cancels, r.cancel)
+	}
+	runningJobsMu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel(cause)
+	}
+}
+
+// Cancels a running or paused job, the fetches in flight are aborted and the
+// recursive jobs stop spawning children. The job is marked as cancelled
+// with the counts it had
+func CancelJob(jobId string) error {
+	err := NewRedisScrapdata().CancelJob(jobId)
+	if err != nil {
+		return err
+	}
+
+	stopJob(jobId, nil)
+	return nil
+}
+
+// sends the item unless the job is done, a cancelled job never blocks on a full channel
+func sendItem(ctx context.Context, items chan ItemResult, it ItemResult) bool {
+	select {
+	case items <- it:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
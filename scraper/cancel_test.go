@@ -0,0 +1,130 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCancelJob(t *testing.T) {
+	Convey("A cancelled job stops with the counts it had", t, func() {
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/robots.txt":
+				http.NotFound(w, r)
+			case "/slow.html":
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+				w.Write([]byte(example1))
+			default:
+				w.Write([]byte("<html><body>" + strings.Repeat(`<div class="product-info"><h2>Test</h2></div>`, 250) + "</body></html>"))
+			}
+		}))
+		defer ts.Close()
+		defer close(release)
+
+		s := ScrapSelector{Url: ts.URL + "/slow.html", Base: ".product-info", Title: Selector{Exp: "h2"}}
+		rdata := NewRedisScrapdata()
+
+		Convey("the fetches in flight are aborted", func() {
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			time.Sleep(100 * time.Millisecond)
+			So(CancelJob(jobId), ShouldBeNil)
+			So(drainItems(items, time.Second), ShouldEqual, 0)
+
+			job, err := rdata.ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			meta := job["meta"].(map[string]string)
+			So(meta["status"], ShouldEqual, JobStatusCancelled)
+			So(meta["errors"], ShouldEqual, "")
+			So(meta["finish"], ShouldNotEqual, "")
+
+			So(CancelJob(jobId), ShouldEqual, ErrJobNotRunning)
+		})
+
+		Convey("the job does not block on a full items channel", func() {
+			s.Url = ts.URL + "/list.html"
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			time.Sleep(200 * time.Millisecond)
+			So(CancelJob(jobId), ShouldBeNil)
+			So(drainItems(items, time.Second), ShouldBeLessThanOrEqualTo, bufferItemsSize)
+		})
+
+		Convey("a job cancelled by its context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			jobId, items, err := NewScrapper().Scrap(ctx, s)
+			So(err, ShouldBeNil)
+
+			cancel()
+			So(drainItems(items, time.Second), ShouldEqual, 0)
+			job, _ := rdata.ScrapJob(jobId)
+			So(job["meta"].(map[string]string)["status"], ShouldEqual, JobStatusCancelled)
+		})
+
+		Convey("an unknown job", func() {
+			So(CancelJob("D-unknown"), ShouldEqual, ErrJobNotFound)
+		})
+	})
+}
+
+func TestJobRuns(t *testing.T) {
+	Convey("Every run of a job releases only its own context", t, func() {
+		paused := jobContext(context.Background(), "D-runs")
+		stopJob("D-runs", errJobPaused)
+		So(context.Cause(paused), ShouldEqual, errJobPaused)
+
+		// resumed before the paused run is released
+		resumed := jobContext(context.Background(), "D-runs")
+		releaseJob(paused, "D-runs")
+		So(resumed.Err(), ShouldBeNil)
+
+		So(runContext("D-runs"), ShouldEqual, resumed)
+
+		stopJob("D-runs", nil)
+		So(resumed.Err(), ShouldNotBeNil)
+		releaseJob(resumed, "D-runs")
+		So(runningJobs["D-runs"], ShouldBeNil)
+		So(runContext("D-runs"), ShouldEqual, context.Background())
+	})
+
+	Convey("A job cancelled in other instance is stopped", t, func() {
+		rdata := NewRedisScrapdata()
+		jobId := NewJobId("D")
+		rdata.StartJob(jobId, ScrapSelector{Url: "http://www.shop.com/list"})
+		ctx := jobContext(context.Background(), jobId)
+		defer releaseJob(ctx, jobId)
+
+		So(jobStopped(ctx), ShouldBeFalse)
+		So(rdata.CancelJob(jobId), ShouldBeNil)
+		So(jobStopped(ctx), ShouldBeTrue)
+	})
+}
+
+// items received until the channel is closed, -1 if it is not closed in time
+func drainItems(items chan ItemResult, timeout time.Duration) int {
+	count := 0
+	deadline := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-items:
+			if !ok {
+				return count
+			}
+			count++
+		case <-deadline:
+			return -1
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package scraper
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+var (
+	ErrUnknownCharset = fmt.Errorf("InvalidSelector the charset is unknown")
+)
+
+// the body transcoded to UTF-8 and the name of its charset, detected from the selector
+// override, the BOM, the Content-Type, the meta tags or sniffing the body
+func decodeCharset(selector ScrapSelector, body []byte, contentType string) ([]byte, string, error) {
+	if selector.Charset != "" {
+		e, name := charset.Lookup(selector.Charset)
+		if e == nil {
+			return nil, "", ErrUnknownCharset
+		}
+		return transcode(body, e, name)
+	}
+
+	e, name, certain := charset.DetermineEncoding(body, contentType)
+	// only the first 1024 bytes are sniffed, the rest of the page can be UTF-8
+	if !certain && name == "windows-1252" && utf8.Valid(body) {
+		return body, "utf-8", nil
+	}
+	return transcode(body, e, name)
+}
+
+func transcode(body []byte, e encoding.Encoding, name string) ([]byte, string, error) {
+	if name == "utf-8" {
+		return body, name, nil
+	}
+	decoded, err := e.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, name, err
+	}
+	return decoded, name, nil
+}
@@ -0,0 +1,115 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func encodedPage(title string, enc interface {
+	String(string) (string, error)
+}) string {
+	s, err := enc.String(title)
+	So(err, ShouldBeNil)
+	return s
+}
+
+func TestCharsetDetection(t *testing.T) {
+	Convey("Pages are transcoded to UTF-8 before the scrap", t, func() {
+		pages := map[string]struct {
+			contentType string
+			body        string
+		}{}
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := pages[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", p.contentType)
+			w.Write([]byte(p.body))
+		}))
+		defer ts.Close()
+
+		product := func(title string) string {
+			return `<div class="product-info"><h2>` + title + `</h2></div>`
+		}
+
+		scrapTitle := func(s ScrapSelector) string {
+			_, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			title := ""
+			for it := range items {
+				title = it.Item.Title
+			}
+			return title
+		}
+
+		s := ScrapSelector{Base: ".product-info", Title: Selector{Exp: "h2"}}
+
+		Convey("from the Content-Type header", func() {
+			pages["/jp.html"] = struct{ contentType, body string }{
+				"text/html; charset=Shift_JIS",
+				"<html><body>" + encodedPage(product("日本のお茶"), japanese.ShiftJIS.NewEncoder()) + "</body></html>",
+			}
+			s.Url = ts.URL + "/jp.html"
+			So(scrapTitle(s), ShouldEqual, "日本のお茶")
+
+			rdata := NewRedisScrapdata()
+			runs, err := rdata.JobRuns(s.Url)
+			So(err, ShouldBeNil)
+			job, err := rdata.ScrapJob(runs[0])
+			So(err, ShouldBeNil)
+			So(job["meta"].(map[string]string)["charset:shift_jis"], ShouldEqual, "1")
+		})
+
+		Convey("from the meta tags", func() {
+			pages["/ru.html"] = struct{ contentType, body string }{
+				"text/html",
+				`<html><head><meta charset="windows-1251"></head><body>` +
+					encodedPage(product("Чай"), charmap.Windows1251.NewEncoder()) + "</body></html>",
+			}
+			s.Url = ts.URL + "/ru.html"
+			So(scrapTitle(s), ShouldEqual, "Чай")
+		})
+
+		Convey("sniffing the body", func() {
+			pages["/fr.html"] = struct{ contentType, body string }{
+				"text/html",
+				"<html><body>" + encodedPage(product("Thé à la menthe"), charmap.ISO8859_1.NewEncoder()) + "</body></html>",
+			}
+			s.Url = ts.URL + "/fr.html"
+			So(scrapTitle(s), ShouldEqual, "Thé à la menthe")
+
+			Convey("UTF-8 after the first bytes is kept", func() {
+				padding := "<!--" + string(make([]byte, 2048)) + "-->"
+				pages["/utf8.html"] = struct{ contentType, body string }{
+					"text/html",
+					"<html><body>" + padding + product("Thé à la menthe") + "</body></html>",
+				}
+				s.Url = ts.URL + "/utf8.html"
+				So(scrapTitle(s), ShouldEqual, "Thé à la menthe")
+			})
+		})
+
+		Convey("overridden by the selector", func() {
+			pages["/wrong.html"] = struct{ contentType, body string }{
+				"text/html; charset=utf-8",
+				"<html><body>" + encodedPage(product("Чай"), charmap.Windows1251.NewEncoder()) + "</body></html>",
+			}
+			s.Url = ts.URL + "/wrong.html"
+			s.Charset = "windows-1251"
+			So(scrapTitle(s), ShouldEqual, "Чай")
+
+			s.Charset = "klingon"
+			_, err := SnippetBase(s)
+			So(err, ShouldEqual, ErrUnknownCharset)
+		})
+	})
+}
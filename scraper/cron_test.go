@@ -0,0 +1,58 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCron(t *testing.T) {
+	Convey("The next run of the cron expressions", t, func() {
+		// monday
+		now := time.Date(2026, 3, 2, 10, 17, 30, 0, time.UTC)
+		next := func(expr string) time.Time {
+			c, err := parseCron(expr)
+			So(err, ShouldBeNil)
+			return c.next(now)
+		}
+
+		So(next("* * * * *"), ShouldResemble, time.Date(2026, 3, 2, 10, 18, 0, 0, time.UTC))
+		So(next("*/15 * * * *"), ShouldResemble, time.Date(2026, 3, 2, 10, 30, 0, 0, time.UTC))
+		So(next("5/20 * * * *"), ShouldResemble, time.Date(2026, 3, 2, 10, 25, 0, 0, time.UTC))
+		So(next("0 9-17/4 * * *"), ShouldResemble, time.Date(2026, 3, 2, 13, 0, 0, 0, time.UTC))
+		So(next("30 4 * * *"), ShouldResemble, time.Date(2026, 3, 3, 4, 30, 0, 0, time.UTC))
+		So(next("@daily"), ShouldResemble, time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC))
+		So(next("0 0 1 1 *"), ShouldResemble, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC))
+
+		Convey("the days of the week, 7 is sunday", func() {
+			So(next("0 8 * * 0"), ShouldResemble, time.Date(2026, 3, 8, 8, 0, 0, 0, time.UTC))
+			So(next("0 8 * * 7"), ShouldResemble, time.Date(2026, 3, 8, 8, 0, 0, 0, time.UTC))
+			So(next("0 8 * * 1-5"), ShouldResemble, time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC))
+		})
+
+		Convey("with the day of the month and the week restricted any of them matches", func() {
+			So(next("0 0 15 * 3"), ShouldResemble, time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC))
+			So(next("0 0 3 * 6"), ShouldResemble, time.Date(2026, 3, 3, 0, 0, 0, 0, time.UTC))
+		})
+
+		Convey("in the location of the time", func() {
+			ny, err := time.LoadLocation("America/New_York")
+			So(err, ShouldBeNil)
+			c, _ := parseCron("0 6 * * *")
+			So(c.next(now.In(ny)).UTC(), ShouldResemble, time.Date(2026, 3, 2, 11, 0, 0, 0, time.UTC))
+		})
+
+		Convey("an impossible date", func() {
+			So(next("0 0 30 2 *").IsZero(), ShouldBeTrue)
+		})
+	})
+
+	Convey("The invalid cron expressions", t, func() {
+		for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+			"*/0 * * * *", "5-1 * * * *", "a * * * *", "@every"} {
+			_, err := parseCron(expr)
+			So(err, ShouldEqual, ErrInvalidCron)
+		}
+	})
+}
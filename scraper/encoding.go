@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// encodings negotiated when the header profile does not set them
+	acceptEncoding = "gzip, deflate, br"
+)
+
+// replaces the body with the decompressed one, limited to max bytes once
+// decompressed, the pages and decompression bombs bigger than that fail
+// without reading them. 0 does not limit the body
+func decodeBody(res *http.Response, max int64) error {
+	encoding := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+
+	switch encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		r, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return err
+		}
+		res.Body = readCloser{r, res.Body}
+	case "deflate":
+		// deflate is zlib wrapped, but some servers send it raw
+		br := bufio.NewReader(res.Body)
+		header, _ := br.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			r, err := zlib.NewReader(br)
+			if err != nil {
+				return err
+			}
+			res.Body = readCloser{r, res.Body}
+		} else {
+			res.Body = readCloser{flate.NewReader(br), res.Body}
+		}
+	case "br":
+		res.Body = readCloser{brotli.NewReader(res.Body), res.Body}
+	default:
+		return fmt.Errorf("Content-Encoding %s not supported", encoding)
+	}
+
+	if encoding != "" {
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+	}
+
+	if max > 0 {
+		limited := &maxBodyReader{r: res.Body, max: max, left: max, status: res.StatusCode, encoding: encoding}
+		// the responses read from a WARC file have no request
+		if res.Request != nil {
+			limited.url = res.Request.URL.String()
+		}
+		res.Body = readCloser{limited, res.Body}
+	}
+	return nil
+}
+
+// reads the body failing when it is bigger than the max bytes
+type maxBodyReader struct {
+	r        io.Reader
+	max      int64
+	left     int64
+	url      string
+	status   int
+	encoding string
+}
+
+func (m *maxBodyReader) Read(p []byte) (int, error) {
+	if m.left <= 0 {
+		// one more byte tells if there is more body
+		var b [1]byte
+		n, _ := m.r.Read(b[:])
+		if n == 0 {
+			return 0, io.EOF
+		}
+		msg := fmt.Sprintf("body is bigger than %v bytes", m.max)
+		if m.encoding != "" {
+			msg = fmt.Sprintf("%s body is bigger than %v bytes decompressed", m.encoding, m.max)
+		}
+		return 0, FetchError{Kind: FetchErrorSize, Url: m.url, StatusCode: m.status, Msg: msg}
+	}
+
+	if int64(len(p)) > m.left {
+		p = p[:m.left]
+	}
+	n, err := m.r.Read(p)
+	m.left -= int64(n)
+	return n, err
+}
+
+// reads the decoded body and closes the original one
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
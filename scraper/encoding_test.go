@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func compress(encoding string, body []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	}
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestCompressedBodies(t *testing.T) {
+	Convey("Compressed bodies are negotiated and decoded", t, func() {
+		var accepted string
+		body := []byte(example1)
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			accepted = r.Header.Get("Accept-Encoding")
+			encoding := strings.TrimPrefix(r.URL.Path, "/")
+			header := encoding
+			if encoding == "raw-deflate" {
+				header = "deflate"
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", header)
+			w.Write(compress(encoding, body))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{Base: ".product-info", Title: Selector{Exp: "h2"}}
+
+		for _, encoding := range []string{"gzip", "deflate", "raw-deflate", "br"} {
+			enc := encoding
+			Convey(enc, func() {
+				s.Url = ts.URL + "/" + enc
+				snippet, err := SnippetBase(s)
+				So(err, ShouldBeNil)
+				So(snippet, ShouldContainSubstring, "£ 33.21")
+				So(accepted, ShouldEqual, "gzip, deflate, br")
+			})
+		}
+
+		Convey("decompression bombs are stopped", func() {
+			UseMaxBodyBytes(64 * 1024)
+			defer UseMaxBodyBytes(10 * 1024 * 1024)
+
+			body = bytes.Repeat([]byte("<p>bomb</p>"), 1024*1024)
+			s.Url = ts.URL + "/gzip"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorSize)
+
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			for _ = range items {
+			}
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			So(job["meta"].(map[string]string)["errors:size"], ShouldEqual, "1")
+		})
+	})
+}
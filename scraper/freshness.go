@@ -0,0 +1,380 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dahernan/gopherscraper/elasticsearch"
+	"github.com/dahernan/gopherscraper/model"
+)
+
+var (
+	ErrInvalidFreshness = fmt.Errorf("InvalidFreshness it needs a host, the max age and intervals can not be negative, and the min interval can not be over the max interval")
+	ErrItemNotObserved  = errors.New("Item changes not observed yet")
+
+	defaultFreshness Freshness
+	// pages scraped again in every refresh run
+	refreshBudget int
+)
+
+const (
+	// the interval of an item that did not change grows by half
+	changeBackoff = 1.5
+	// the interval of an item that changed is halved
+	changeTighten = 0.5
+	// results reachable by paging a search, the max_result_window of the index
+	maxStaleWindow = 10000
+)
+
+func init() {
+	UseFreshness(Freshness{
+		MaxAgeSeconds:      60 * 60 * 24,
+		MinIntervalSeconds: 60 * 60,
+		MaxIntervalSeconds: 60 * 60 * 24 * 30,
+	})
+	UseRefreshBudget(500)
+}
+
+// How fresh the items of a host are kept, zero values are taken from the defaults
+type Freshness struct {
+	Host string `json:"host,omitempty"`
+	// the items scraped before are stale
+	MaxAgeSeconds int `json:"maxAgeSeconds,omitempty"`
+	// bounds of the interval learned for every item from its changes
+	MinIntervalSeconds int `json:"minIntervalSeconds,omitempty"`
+	MaxIntervalSeconds int `json:"maxIntervalSeconds,omitempty"`
+}
+
+// default freshness for every host
+func UseFreshness(f Freshness) {
+	defaultFreshness = f
+}
+
+func UseRefreshBudget(pages int) {
+	refreshBudget = pages
+}
+
+func RefreshBudget() int {
+	return refreshBudget
+}
+
+func (f Freshness) merge(base Freshness) Freshness {
+	merged := base
+	if f.MaxAgeSeconds > 0 {
+		merged.MaxAgeSeconds = f.MaxAgeSeconds
+	}
+	if f.MinIntervalSeconds > 0 {
+		merged.MinIntervalSeconds = f.MinIntervalSeconds
+	}
+	if f.MaxIntervalSeconds > 0 {
+		merged.MaxIntervalSeconds = f.MaxIntervalSeconds
+	}
+	return merged
+}
+
+func validateFreshness(f Freshness) error {
+	if f.Host == "" || f.MaxAgeSeconds < 0 || f.MinIntervalSeconds < 0 || f.MaxIntervalSeconds < 0 {
+		return ErrInvalidFreshness
+	}
+	if f.MaxIntervalSeconds > 0 && f.MinIntervalSeconds > f.MaxIntervalSeconds {
+		return ErrInvalidFreshness
+	}
+	return nil
+}
+
+// the interval within the bounds of the host
+func (f Freshness) clamp(seconds int) int {
+	if f.MaxIntervalSeconds > 0 && seconds > f.MaxIntervalSeconds {
+		seconds = f.MaxIntervalSeconds
+	}
+	if seconds < f.MinIntervalSeconds {
+		seconds = f.MinIntervalSeconds
+	}
+	return seconds
+}
+
+// freshness of the host, then the defaults
+func freshnessFor(host string) (Freshness, error) {
+	f := defaultFreshness
+	hostFreshness, err := NewRedisScrapdata().HostFreshness(host)
+	if err != nil {
+		return f, err
+	}
+	f = hostFreshness.merge(f)
+	f.Host = host
+	return f, nil
+}
+
+// Change rate learned for an item, the interval grows while the item does
+// not change and shrinks when it changes
+type ItemChanges struct {
+	Host string `json:"host"`
+	Id   string `json:"id"`
+	Link string `json:"link,omitempty"`
+	// fingerprint of the fields in the last scrap
+	Fingerprint string     `json:"fingerprint"`
+	Checks      int        `json:"checks"`
+	Changes     int        `json:"changes"`
+	LastCheck   time.Time  `json:"lastCheck"`
+	LastChange  *time.Time `json:"lastChange,omitempty"`
+	// the item is scraped again when it is due
+	IntervalSeconds int       `json:"intervalSeconds"`
+	NextDue         time.Time `json:"nextDue"`
+}
+
+// learns from the fingerprint of the item scraped now
+func (c ItemChanges) observe(fingerprint string, now time.Time, f Freshness) ItemChanges {
+	switch {
+	case c.Checks == 0:
+		c.IntervalSeconds = f.clamp(f.MaxAgeSeconds)
+	case fingerprint != c.Fingerprint:
+		c.Changes++
+		c.LastChange = &now
+		c.IntervalSeconds = f.clamp(int(float64(c.IntervalSeconds) * changeTighten))
+	default:
+		c.IntervalSeconds = f.clamp(int(float64(c.IntervalSeconds) * changeBackoff))
+	}
+	c.Checks++
+	c.Fingerprint = fingerprint
+	c.LastCheck = now
+	c.NextDue = now.Add(time.Duration(c.IntervalSeconds) * time.Second)
+	return c
+}
+
+// the item could not be scraped now, it is due again after its interval
+func (c ItemChanges) postpone(now time.Time) ItemChanges {
+	c.NextDue = now.Add(time.Duration(c.IntervalSeconds) * time.Second)
+	return c
+}
+
+// hash of the scraped fields of the item, the metadata is not included
+func itemFingerprint(item model.Item) string {
+	parts := []string{
+		item.Title,
+		item.Description,
+		item.Categories,
+		item.Image,
+		strconv.FormatFloat(item.Price, 'f', -1, 64),
+		item.Currency,
+		strconv.FormatFloat(item.Stars, 'f', -1, 64),
+	}
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// records the scrap of the item in the change rate of its host
+func observeItem(it ItemResult, now time.Time) {
+	index := itemIndex(it)
+	if index == "" || it.Item.Id == "" {
+		return
+	}
+	host := strings.TrimSuffix(index, "/"+it.Item.Id)
+
+	f, err := freshnessFor(host)
+	if err != nil || f.MaxAgeSeconds <= 0 {
+		return
+	}
+
+	data := NewRedisScrapdata()
+	changes, err := data.ItemChanges(host, it.Item.Id)
+	if err != nil && err != ErrItemNotObserved {
+		return
+	}
+	changes.Host = host
+	changes.Id = it.Item.Id
+	if it.Item.Link != "" {
+		changes.Link = it.Item.Link
+	}
+
+	err = data.SaveItemChanges(changes.observe(itemFingerprint(it.Item), now, f))
+	if err != nil {
+		log.Printf("ERROR: saving the changes of %s %v", index, err.Error())
+	}
+}
+
+// item to scrap again
+type staleItem struct {
+	host string
+	item *model.Item
+	// the changes of the observed items, nil for the others
+	changes *ItemChanges
+	// age over the interval of the item, weighted by its views
+	priority float64
+}
+
+func refreshPriority(age time.Duration, interval time.Duration, views int) float64 {
+	return float64(age) / float64(interval) * (1 + math.Log1p(float64(views)))
+}
+
+type RefreshResult struct {
+	// job started for every host
+	Jobs map[string]string `json:"jobs"`
+	// stale items found and the ones scraped again in this run
+	Stale     int `json:"stale"`
+	Refreshed int `json:"refreshed"`
+}
+
+// Refresher scraps again the stale items of the index with the detail
+// selector of their host
+type Refresher struct {
+	Id    string
+	store ScrapAndStoreItems
+	// items of the host scraped before the time, the oldest first
+	staleItems func(host string, before time.Time, from int, size int) ([]*model.Item, error)
+}
+
+func NewRefresher(index string, store ScrapAndStoreItems) *Refresher {
+	host, _ := os.Hostname()
+	return &Refresher{
+		Id:         fmt.Sprintf("%s-%d", host, os.Getpid()),
+		store:      store,
+		staleItems: elastic.NewItemElastic(index).StaleItems,
+	}
+}
+
+// refreshes every interval until the context is done, only the instance
+// holding the leader lock refreshes
+func (rf *Refresher) Run(ctx context.Context, interval time.Duration) {
+	log.Printf("INFO: Refresher [%s] started every %v\n", rf.Id, interval)
+	data := NewRedisScrapdata()
+	ttl := int(2 * interval / time.Second)
+
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			log.Printf("INFO: Refresher [%s] stopped\n", rf.Id)
+			return
+		}
+
+		if !data.LeaderLock("refresher", rf.Id, ttl) {
+			continue
+		}
+		_, err := rf.Refresh(time.Now(), refreshBudget)
+		if err != nil {
+			log.Printf("ERROR: Refresher [%s] %v", rf.Id, err.Error())
+		}
+	}
+}
+
+// Scraps again the stale items of the hosts with a detail selector, the
+// stalest and most viewed first, up to budget pages. The items with a change
+// rate learned are due after their own interval, the others after the max
+// age of the host. Every host gets a job
+func (rf *Refresher) Refresh(now time.Time, budget int) (RefreshResult, error) {
+	result := RefreshResult{Jobs: map[string]string{}}
+	data := NewRedisScrapdata()
+
+	hosts, err := data.DetailSelectorHosts()
+	if err != nil {
+		return result, err
+	}
+
+	var stale []staleItem
+	for _, host := range hosts {
+		f, err := freshnessFor(host)
+		if err != nil || f.MaxAgeSeconds <= 0 {
+			continue
+		}
+		maxAge := time.Duration(f.MaxAgeSeconds) * time.Second
+
+		due, err := data.DueItems(host, now, budget)
+		if err != nil {
+			log.Printf("ERROR: Refresher [%s] due items of %s %v", rf.Id, host, err.Error())
+		}
+		for i, c := range due {
+			// without a link the item can not be scraped again, it leaves the due items
+			if c.Link == "" {
+				data.RemoveDueItem(host, c.Id)
+				continue
+			}
+			interval := time.Duration(c.IntervalSeconds) * time.Second
+			priority := refreshPriority(now.Sub(c.LastCheck), interval, data.ItemViews(host, c.Id))
+			stale = append(stale, staleItem{host: host, item: &model.Item{Id: c.Id, Link: c.Link}, changes: &due[i], priority: priority})
+		}
+
+		// the observed items are due by their change rate, the stale items
+		// are paged until the budget of items not observed is found
+		found := 0
+		for from := 0; found < budget && from < maxStaleWindow; from += budget {
+			items, err := rf.staleItems(host, now.Add(-maxAge), from, budget)
+			if err != nil {
+				log.Printf("ERROR: Refresher [%s] stale items of %s %v", rf.Id, host, err.Error())
+				break
+			}
+
+			for _, it := range items {
+				lastScrap, err := time.Parse(time.RFC3339, it.LastScrap)
+				if err != nil || it.Link == "" {
+					continue
+				}
+				if _, err := data.ItemChanges(host, it.Id); err != ErrItemNotObserved {
+					continue
+				}
+				priority := refreshPriority(now.Sub(lastScrap), maxAge, data.ItemViews(host, it.Id))
+				stale = append(stale, staleItem{host: host, item: it, priority: priority})
+				found++
+			}
+			if len(items) < budget {
+				break
+			}
+		}
+	}
+
+	result.Stale = len(stale)
+	sort.Sort(byPriority(stale))
+	if len(stale) > budget {
+		stale = stale[:budget]
+	}
+
+	pages := map[string][]ScrapSelector{}
+	for _, s := range stale {
+		selector, err := data.Selector(s.item.Link, SelectorTypeDetail)
+		if err != nil {
+			// the due item does not stay first in the due items of the host
+			if s.changes != nil {
+				data.SaveItemChanges(s.changes.postpone(now))
+			}
+			continue
+		}
+		selector.Recursive = false
+		pages[s.host] = append(pages[s.host], selector)
+	}
+
+	for host, hostPages := range pages {
+		// the job is described by the detail selector on the root of the host
+		jobSelector := hostPages[0]
+		if u, err := neturl.Parse(jobSelector.Url); err == nil {
+			jobSelector.Url = u.Scheme + "://" + host + "/"
+		}
+
+		jobId := NewJobId("F")
+		err := rf.store.ScrapPagesAndStore(jobId, jobSelector, hostPages)
+		if err != nil {
+			log.Printf("ERROR: Refresher [%s] refreshing %s %v", rf.Id, host, err.Error())
+			continue
+		}
+		result.Jobs[host] = jobId
+		result.Refreshed += len(hostPages)
+	}
+
+	log.Printf("INFO: Refresher [%s] %d stale items, %d scraped again\n", rf.Id, result.Stale, result.Refreshed)
+	return result, nil
+}
+
+type byPriority []staleItem
+
+func (a byPriority) Len() int           { return len(a) }
+func (a byPriority) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byPriority) Less(i, j int) bool { return a[i].priority > a[j].priority }
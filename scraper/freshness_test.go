@@ -0,0 +1,225 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dahernan/gopherscraper/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordedJobs struct {
+	pages map[string][]ScrapSelector
+}
+
+func (r recordedJobs) ScrapAndStore(selector ScrapSelector) (string, error) {
+	return "", nil
+}
+
+func (r recordedJobs) ResumeAndStore(jobId string) error {
+	return nil
+}
+
+func (r recordedJobs) ScrapPagesAndStore(jobId string, selector ScrapSelector, pages []ScrapSelector) error {
+	r.pages[jobId] = pages
+	return nil
+}
+
+// the page of the items from the offset
+func pageItems(items []*model.Item, from int, size int) []*model.Item {
+	if from >= len(items) {
+		return nil
+	}
+	if from+size > len(items) {
+		return items[from:]
+	}
+	return items[from : from+size]
+}
+
+func TestRefresh(t *testing.T) {
+	Convey("The stale items are scraped again, the stalest and most viewed first", t, func() {
+		rdata := NewRedisScrapdata()
+		for _, url := range []string{"http://www.fresh-a.com/p", "http://www.fresh-b.com/p"} {
+			err := rdata.SaveSelector(ScrapSelector{Url: url, Stype: SelectorTypeDetail, Base: ".product"})
+			So(err, ShouldBeNil)
+		}
+		So(rdata.SaveHostFreshness(Freshness{Host: "www.fresh-b.com", MaxAgeSeconds: 60 * 60 * 12}), ShouldBeNil)
+		defer rdata.DeleteHostFreshness("www.fresh-b.com")
+		So(rdata.SaveHostFreshness(Freshness{MaxAgeSeconds: 10}), ShouldEqual, ErrInvalidFreshness)
+
+		now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+		ago := func(d time.Duration) string {
+			return now.Add(-d).Format(time.RFC3339)
+		}
+		stale := map[string][]*model.Item{
+			"www.fresh-a.com": {
+				{Id: "a1", Link: "http://www.fresh-a.com/p/1", LastScrap: ago(72 * time.Hour)},
+				{Id: "a2", Link: "http://www.fresh-a.com/p/2", LastScrap: ago(48 * time.Hour)},
+			},
+			"www.fresh-b.com": {
+				{Id: "b1", Link: "http://www.fresh-b.com/p/1", LastScrap: ago(24 * time.Hour)},
+				{Id: "b2", Link: "http://www.fresh-b.com/p/2", LastScrap: "yesterday"},
+			},
+		}
+		before := map[string]time.Time{}
+
+		jobs := recordedJobs{pages: map[string][]ScrapSelector{}}
+		rf := &Refresher{Id: "test", store: jobs, staleItems: func(host string, t time.Time, from int, size int) ([]*model.Item, error) {
+			before[host] = t
+			return pageItems(stale[host], from, size), nil
+		}}
+
+		rdata.client.Del(scrapViewsKey("www.fresh-a.com"))
+		for i := 0; i < 10; i++ {
+			rdata.ItemViewed("www.fresh-a.com", "a2")
+		}
+		So(rdata.ItemViews("www.fresh-a.com", "a2"), ShouldEqual, 10)
+
+		Convey("within the budget", func() {
+			result, err := rf.Refresh(now, 2)
+			So(err, ShouldBeNil)
+			So(result.Stale, ShouldEqual, 3)
+			So(result.Refreshed, ShouldEqual, 2)
+			So(before["www.fresh-a.com"], ShouldResemble, now.Add(-24*time.Hour))
+			So(before["www.fresh-b.com"], ShouldResemble, now.Add(-12*time.Hour))
+
+			So(len(result.Jobs), ShouldEqual, 1)
+			jobId := result.Jobs["www.fresh-a.com"]
+			So(jobId, ShouldStartWith, "F")
+			pages := jobs.pages[jobId]
+			So(len(pages), ShouldEqual, 2)
+			So(pages[0].Url, ShouldEqual, "http://www.fresh-a.com/p/2")
+			So(pages[1].Url, ShouldEqual, "http://www.fresh-a.com/p/1")
+			So(pages[0].Base, ShouldEqual, ".product")
+		})
+
+		Convey("a job for every host", func() {
+			result, err := rf.Refresh(now, 10)
+			So(err, ShouldBeNil)
+			So(result.Refreshed, ShouldEqual, 3)
+			So(len(result.Jobs), ShouldEqual, 2)
+			So(jobs.pages[result.Jobs["www.fresh-b.com"]][0].Url, ShouldEqual, "http://www.fresh-b.com/p/1")
+		})
+	})
+}
+
+func TestItemChanges(t *testing.T) {
+	Convey("The interval of an item is learned from its changes within the bounds", t, func() {
+		f := Freshness{Host: "www.fresh-c.com", MaxAgeSeconds: 3600, MinIntervalSeconds: 1000, MaxIntervalSeconds: 8000}
+		now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+		c := ItemChanges{}.observe("a", now, f)
+		So(c.Checks, ShouldEqual, 1)
+		So(c.IntervalSeconds, ShouldEqual, 3600)
+		So(c.NextDue, ShouldResemble, now.Add(time.Hour))
+
+		Convey("it backs off while the item does not change", func() {
+			c = c.observe("a", now, f)
+			So(c.IntervalSeconds, ShouldEqual, 5400)
+			c = c.observe("a", now, f)
+			So(c.IntervalSeconds, ShouldEqual, 8000)
+			So(c.Changes, ShouldEqual, 0)
+			So(c.LastChange, ShouldBeNil)
+		})
+
+		Convey("it tightens when the item changes", func() {
+			c = c.observe("b", now, f)
+			So(c.IntervalSeconds, ShouldEqual, 1800)
+			So(c.Changes, ShouldEqual, 1)
+			So(*c.LastChange, ShouldResemble, now)
+			c = c.observe("c", now, f)
+			So(c.IntervalSeconds, ShouldEqual, 1000)
+			So(c.NextDue, ShouldResemble, now.Add(1000*time.Second))
+		})
+
+		Convey("the bounds have to be valid", func() {
+			So(validateFreshness(Freshness{Host: "www.fresh-c.com", MinIntervalSeconds: 10, MaxIntervalSeconds: 5}), ShouldEqual, ErrInvalidFreshness)
+			So(validateFreshness(Freshness{Host: "www.fresh-c.com", MinIntervalSeconds: -1}), ShouldEqual, ErrInvalidFreshness)
+		})
+	})
+
+	Convey("The observed items are refreshed when they are due", t, func() {
+		rdata := NewRedisScrapdata()
+		host := "www.fresh-d.com"
+		err := rdata.SaveSelector(ScrapSelector{Url: "http://" + host + "/p", Stype: SelectorTypeDetail, Base: ".product"})
+		So(err, ShouldBeNil)
+		So(rdata.SaveHostFreshness(Freshness{Host: host, MaxAgeSeconds: 3600, MinIntervalSeconds: 600}), ShouldBeNil)
+		defer rdata.DeleteHostFreshness(host)
+		rdata.client.Del(scrapChangesKey(host), scrapDueKey(host))
+
+		_, err = rdata.ItemChanges(host, "d1")
+		So(err, ShouldEqual, ErrItemNotObserved)
+
+		scrapped := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+		scrap := func(id string, title string) {
+			observeItem(ItemResult{Item: model.Item{
+				Id:       id,
+				Title:    title,
+				Link:     "http://" + host + "/p/" + id,
+				ScrapUrl: "http://" + host + "/p/" + id,
+			}}, scrapped)
+		}
+		scrap("d1", "volatile")
+		scrap("d1", "volatile, now cheaper")
+		scrap("d2", "quiet")
+		scrap("d2", "quiet")
+
+		d1, err := rdata.ItemChanges(host, "d1")
+		So(err, ShouldBeNil)
+		So(d1.Changes, ShouldEqual, 1)
+		So(d1.IntervalSeconds, ShouldEqual, 1800)
+		So(d1.NextDue, ShouldResemble, scrapped.Add(30*time.Minute))
+		d2, _ := rdata.ItemChanges(host, "d2")
+		So(d2.IntervalSeconds, ShouldEqual, 5400)
+
+		jobs := recordedJobs{pages: map[string][]ScrapSelector{}}
+		rf := &Refresher{Id: "test", store: jobs, staleItems: func(h string, t time.Time, from int, size int) ([]*model.Item, error) {
+			if h != host {
+				return nil, nil
+			}
+			// the observed item is the oldest, the one not observed comes after it
+			return pageItems([]*model.Item{
+				{Id: "d2", Link: "http://" + host + "/p/d2", LastScrap: t.Add(-2 * time.Hour).Format(time.RFC3339)},
+				{Id: "d3", Link: "http://" + host + "/p/d3", LastScrap: t.Add(-time.Hour).Format(time.RFC3339)},
+			}, from, size), nil
+		}}
+
+		result, err := rf.Refresh(scrapped.Add(time.Hour), 10)
+		So(err, ShouldBeNil)
+		pages := jobs.pages[result.Jobs[host]]
+		So(len(pages), ShouldEqual, 2)
+		urls := []string{pages[0].Url, pages[1].Url}
+		So(urls, ShouldContain, "http://"+host+"/p/d1")
+		So(urls, ShouldContain, "http://"+host+"/p/d3")
+
+		result, err = rf.Refresh(scrapped.Add(2*time.Hour), 10)
+		So(err, ShouldBeNil)
+		So(len(jobs.pages[result.Jobs[host]]), ShouldEqual, 3)
+
+		Convey("the observed items do not hide the next page of stale items", func() {
+			result, err := rf.Refresh(scrapped.Add(time.Hour), 1)
+			So(err, ShouldBeNil)
+			So(result.Stale, ShouldEqual, 2)
+			So(result.Refreshed, ShouldEqual, 1)
+		})
+
+		Convey("the due items that can not be scraped again do not stay due", func() {
+			now := scrapped.Add(3 * time.Hour)
+			rdata.SaveItemChanges(ItemChanges{Host: host, Id: "d8", IntervalSeconds: 600, NextDue: scrapped})
+			rdata.SaveItemChanges(ItemChanges{Host: host, Id: "d9", Link: "http://other.fresh-d.com/p/d9", IntervalSeconds: 600, NextDue: scrapped})
+
+			_, err := rf.Refresh(now, 10)
+			So(err, ShouldBeNil)
+
+			d9, err := rdata.ItemChanges(host, "d9")
+			So(err, ShouldBeNil)
+			So(d9.NextDue, ShouldResemble, now.Add(10*time.Minute))
+
+			due, err := rdata.DueItems(host, now, 10)
+			So(err, ShouldBeNil)
+			for _, c := range due {
+				So(c.Id, ShouldNotBeIn, []string{"d8", "d9"})
+			}
+		})
+	})
+}
@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/dahernan/gopherscraper/model"
+)
+
+const (
+	// hash of the normalized link of the item
+	IdFallbackLink = "link"
+	// hash of the fields of IdFallbackFields
+	IdFallbackFields = "fields"
+	// hash of the html of the item
+	IdFallbackContent = "content"
+)
+
+var (
+	ErrInvalidIdFallback = errors.New("Invalid idFallback, the fields are link, image, title, description, categories, price, currency or stars")
+
+	defaultIdFallback string
+
+	// fields of the item that do not change between scraps, hashed for the
+	// items of a list without their own link. The content is only hashed when it is asked
+	stableIdFields = []string{"title", "image"}
+
+	// fields of the item that can be hashed for the fallback id
+	idFields = map[string]bool{
+		"link": true, "image": true, "title": true, "description": true,
+		"categories": true, "price": true, "currency": true, "stars": true,
+	}
+)
+
+func init() {
+	UseIdFallback(IdFallbackLink)
+}
+
+// how the id is generated for the items without id, by default the link
+func UseIdFallback(strategy string) {
+	defaultIdFallback = strategy
+}
+
+// the fallback id of the item, used when the id selector matches nothing
+func fallbackId(s *goquery.Selection, selector ScrapSelector, item model.Item) string {
+	strategy := selector.IdFallback
+	if strategy == "" {
+		strategy = defaultIdFallback
+	}
+
+	if strategy == IdFallbackFields && len(selector.IdFallbackFields) == 0 {
+		strategy = IdFallbackLink
+	}
+
+	var parts []string
+	switch strategy {
+	case IdFallbackFields:
+		for _, field := range selector.IdFallbackFields {
+			parts = append(parts, itemField(item, field))
+		}
+	case IdFallbackContent:
+		html, _ := s.Html()
+		parts = []string{strings.Join(strings.Fields(html), " ")}
+	default:
+		parts = []string{item.Link}
+		// the items of a list without their own link have the link of the page
+		if item.Link == item.CanonicalUrl && selector.Stype != SelectorTypeDetail {
+			for _, field := range stableIdFields {
+				parts = append(parts, itemField(item, field))
+			}
+		}
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	return fmt.Sprintf("%x", h.Sum64())
+}
+
+// the strategy and the fields of the fallback id are known
+func validateIdFallback(selector ScrapSelector) error {
+	switch selector.IdFallback {
+	case "", IdFallbackLink, IdFallbackFields, IdFallbackContent:
+	default:
+		return ErrInvalidIdFallback
+	}
+	for _, field := range selector.IdFallbackFields {
+		if !idFields[strings.ToLower(field)] {
+			return ErrInvalidIdFallback
+		}
+	}
+	return nil
+}
+
+func itemField(item model.Item, field string) string {
+	switch strings.ToLower(field) {
+	case "link":
+		return item.Link
+	case "image":
+		return item.Image
+	case "title":
+		return item.Title
+	case "description":
+		return item.Description
+	case "categories":
+		return item.Categories
+	case "price":
+		return strconv.FormatFloat(item.Price, 'f', -1, 64)
+	case "currency":
+		return item.Currency
+	case "stars":
+		return strconv.FormatFloat(item.Stars, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,94 @@
+package scraper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const listWithoutIds = `<html><body>
+	<div class="product"><a href="/p/1?utm_source=x">Shoe</a><span class="price">10.5</span></div>
+	<div class="product"><a href="/p/2">Boot</a><span class="price">20</span></div>
+	<div class="product"><a href="/p/1">Shoe</a><span class="price">10.5</span></div>
+</body></html>`
+
+func scrapIds(s ScrapSelector) []string {
+	_, items, _ := ScrapperFromReader(strings.NewReader(listWithoutIds)).Scrap(context.Background(), s)
+	var ids []string
+	for it := range items {
+		ids = append(ids, it.Item.Id)
+	}
+	return ids
+}
+
+func TestFallbackIds(t *testing.T) {
+	Convey("The items without id get a deterministic fallback id", t, func() {
+		s := ScrapSelector{
+			Url:      "http://www.shop.com/list",
+			Base:     ".product",
+			Id:       Selector{Exp: ".sku"},
+			IdPrefix: "shop-",
+			Link:     Selector{Exp: "a", Attr: "href"},
+			Title:    Selector{Exp: "a"},
+			Price:    Selector{Exp: ".price"},
+		}
+
+		Convey("a hash of the normalized link", func() {
+			ids := scrapIds(s)
+			So(len(ids), ShouldEqual, 3)
+			So(ids[0], ShouldStartWith, "shop-")
+			So(len(ids[0]), ShouldBeGreaterThan, len("shop-"))
+			So(ids[0], ShouldNotEqual, ids[1])
+			So(ids[0], ShouldEqual, ids[2])
+			So(scrapIds(s), ShouldResemble, ids)
+		})
+
+		Convey("a hash of the fields", func() {
+			s.IdFallback = IdFallbackFields
+			s.IdFallbackFields = []string{"title", "price"}
+			ids := scrapIds(s)
+			So(ids[0], ShouldNotEqual, ids[1])
+			So(ids[0], ShouldEqual, ids[2])
+		})
+
+		Convey("a fingerprint of the content", func() {
+			s.IdFallback = IdFallbackContent
+			ids := scrapIds(s)
+			So(ids[0], ShouldNotEqual, ids[1])
+			So(ids[0], ShouldNotEqual, ids[2])
+		})
+
+		Convey("a list without links uses the stable fields", func() {
+			s.Link = Selector{}
+			ids := scrapIds(s)
+			So(ids[0], ShouldNotEqual, ids[1])
+			So(ids[0], ShouldEqual, ids[2])
+		})
+
+		Convey("a link selector without matches uses the stable fields", func() {
+			s.Link = Selector{Exp: "a.missing", Attr: "href"}
+			ids := scrapIds(s)
+			So(ids[0], ShouldNotEqual, ids[1])
+			So(ids[0], ShouldEqual, ids[2])
+		})
+
+		Convey("unknown fields are rejected", func() {
+			s.IdFallback = IdFallbackFields
+			s.IdFallbackFields = []string{"title", "prize"}
+			So(validateSelector(s), ShouldEqual, ErrInvalidIdFallback)
+
+			s.IdFallbackFields = []string{"Title", "price"}
+			So(validateSelector(s), ShouldBeNil)
+
+			s.IdFallback = "html"
+			So(validateSelector(s), ShouldEqual, ErrInvalidIdFallback)
+		})
+
+		Convey("the id found is kept", func() {
+			s.Id = Selector{Exp: ".price"}
+			So(scrapIds(s)[1], ShouldEqual, "shop-20")
+		})
+	})
+}
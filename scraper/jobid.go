@@ -0,0 +1,69 @@
+package scraper
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	// Crockford's base32, the ids sort by time as strings
+	jobIdAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+)
+
+var (
+	jobIdMu      sync.Mutex
+	lastJobIdMs  uint64
+	lastJobIdRnd [10]byte
+)
+
+// Unique id for a scrap run, the source letter of the scrapper followed by
+// a ULID: 48 bits of unix time in milliseconds and 80 random bits, the ids
+// generated in the same millisecond increment the random part
+func NewJobId(source string) string {
+	return source + newUlid(time.Now())
+}
+
+func newUlid(t time.Time) string {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+
+	jobIdMu.Lock()
+	if ms <= lastJobIdMs {
+		ms = lastJobIdMs
+		incrementRandom(&lastJobIdRnd)
+	} else {
+		rand.Read(lastJobIdRnd[:])
+		lastJobIdMs = ms
+	}
+	rnd := lastJobIdRnd
+	jobIdMu.Unlock()
+
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	copy(b[6:], rnd[:])
+	return encodeUlid(b)
+}
+
+func incrementRandom(rnd *[10]byte) {
+	for i := len(rnd) - 1; i >= 0; i-- {
+		rnd[i]++
+		if rnd[i] != 0 {
+			return
+		}
+	}
+}
+
+// 128 bits as 26 characters of 5 bits, the first one has only 3 bits
+func encodeUlid(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = jobIdAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi = hi >> 5
+	}
+	return string(out[:])
+}
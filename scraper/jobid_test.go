@@ -0,0 +1,52 @@
+package scraper
+
+import (
+	"encoding/binary"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJobIds(t *testing.T) {
+	Convey("Job ids are unique and sorted by time", t, func() {
+		Convey("the timestamp is encoded in the first characters", func() {
+			var b [16]byte
+			binary.BigEndian.PutUint64(b[:8], 1469918176385<<16)
+			id := encodeUlid(b)
+			So(len(id), ShouldEqual, 26)
+			So(id, ShouldEqual, "01ARYZ6S410000000000000000")
+		})
+
+		Convey("the ids of the same millisecond are unique and ordered", func() {
+			var ids []string
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				id := NewJobId("D")
+				So(seen[id], ShouldBeFalse)
+				seen[id] = true
+				ids = append(ids, id)
+			}
+			So(sort.StringsAreSorted(ids), ShouldBeTrue)
+		})
+
+		Convey("every run of a url has its own job", func() {
+			s := ScrapSelector{Url: "http://localhost/runs.html", Base: ".product-info"}
+			rdata := NewRedisScrapdata()
+
+			first := NewJobId("D")
+			second := NewJobId("D")
+			rdata.StartJob(first, s)
+			rdata.JobError(first, FetchError{Kind: FetchErrorStatus, StatusCode: 500})
+			rdata.StartJob(second, s)
+
+			runs, err := rdata.JobRuns(s.Url)
+			So(err, ShouldBeNil)
+			So(runs[:2], ShouldResemble, []string{second, first})
+
+			job, err := rdata.ScrapJob(first)
+			So(err, ShouldBeNil)
+			So(job["meta"].(map[string]string)["errors:status"], ShouldEqual, "1")
+		})
+	})
+}
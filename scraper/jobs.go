@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	JobStatusRunning   = "running"
+	JobStatusFinished  = "finished"
+	JobStatusCancelled = "cancelled"
+	JobStatusPaused    = "paused"
+
+	defaultJobsLimit = 20
+	maxJobsLimit     = 100
+)
+
+var (
+	jobStatuses = []string{JobStatusRunning, JobStatusFinished, JobStatusCancelled, JobStatusPaused}
+
+	// seconds to keep the meta of the jobs
+	jobRetention int
+)
+
+func init() {
+	UseJobRetention(60 * 60 * 24 * 7)
+}
+
+// set how long the summaries of the jobs are kept, the items of a job expire in 10 minutes
+func UseJobRetention(seconds int) {
+	jobRetention = seconds
+}
+
+// Filters to list the jobs, the empty values match any job
+type JobFilter struct {
+	Host          string
+	Status        string
+	StartedAfter  time.Time
+	StartedBefore time.Time
+	// only the jobs with errors, or without errors
+	HasErrors *bool
+	Offset    int
+	Limit     int
+}
+
+type JobSummary struct {
+	JobId  string     `json:"jobId"`
+	Url    string     `json:"url"`
+	Host   string     `json:"host"`
+	Status string     `json:"status"`
+	Start  time.Time  `json:"start"`
+	Finish *time.Time `json:"finish,omitempty"`
+	// until now for the running jobs
+	DurationSeconds int64 `json:"durationSeconds"`
+	Items           int   `json:"items"`
+	Errors          int   `json:"errors"`
+	// fingerprint of the selector used by the job
+	Selector string `json:"selector"`
+}
+
+type JobList struct {
+	// jobs matching the filter, before the pagination
+	Total int          `json:"total"`
+	Jobs  []JobSummary `json:"jobs"`
+}
+
+func (f JobFilter) limit() int {
+	if f.Limit <= 0 {
+		return defaultJobsLimit
+	}
+	if f.Limit > maxJobsLimit {
+		return maxJobsLimit
+	}
+	return f.Limit
+}
+
+func jobSummary(jobId string, meta map[string]string, now time.Time) JobSummary {
+	job := JobSummary{
+		JobId:    jobId,
+		Url:      meta["url"],
+		Host:     meta["host"],
+		Status:   meta["status"],
+		Selector: meta["selector"],
+	}
+	job.Items, _ = strconv.Atoi(meta["items"])
+	job.Errors, _ = strconv.Atoi(meta["errors"])
+
+	start, _ := strconv.ParseInt(meta["start"], 10, 64)
+	job.Start = time.Unix(start, 0)
+	end := now
+	if finish, err := strconv.ParseInt(meta["finish"], 10, 64); err == nil {
+		t := time.Unix(finish, 0)
+		job.Finish = &t
+		end = t
+	}
+	job.DurationSeconds = int64(end.Sub(job.Start) / time.Second)
+
+	// jobs started before the status was recorded
+	if job.Status == "" {
+		job.Status = JobStatusRunning
+		if job.Finish != nil {
+			job.Status = JobStatusFinished
+		}
+	}
+	return job
+}
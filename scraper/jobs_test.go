@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJobListing(t *testing.T) {
+	Convey("The jobs are listed with filters and pagination", t, func() {
+		rdata := NewRedisScrapdata()
+		s := ScrapSelector{Url: "http://jobs.example.com/list.html", Base: ".product-info"}
+
+		finished := NewJobId("D")
+		rdata.StartJob(finished, s)
+		rdata.FinishJob(finished)
+
+		failed := NewJobId("D")
+		rdata.StartJob(failed, s)
+		rdata.JobError(failed, FetchError{Kind: FetchErrorStatus, StatusCode: 503})
+		rdata.FinishJob(failed)
+
+		running := NewJobId("D")
+		rdata.StartJob(running, s)
+
+		host := JobFilter{Host: "jobs.example.com"}
+
+		Convey("the newest first with the summary of every job", func() {
+			list, err := rdata.Jobs(host)
+			So(err, ShouldBeNil)
+			So(list.Total, ShouldEqual, 3)
+			So(list.Jobs[0].JobId, ShouldEqual, running)
+			So(list.Jobs[0].Status, ShouldEqual, JobStatusRunning)
+			So(list.Jobs[0].Finish, ShouldBeNil)
+			So(list.Jobs[1].JobId, ShouldEqual, failed)
+			So(list.Jobs[1].Status, ShouldEqual, JobStatusFinished)
+			So(list.Jobs[1].Errors, ShouldEqual, 1)
+			So(list.Jobs[1].Url, ShouldEqual, s.Url)
+			So(list.Jobs[1].Selector, ShouldEqual, selectorFingerprint(s))
+			So(list.Jobs[1].DurationSeconds, ShouldBeGreaterThanOrEqualTo, 0)
+		})
+
+		Convey("by status and errors", func() {
+			filter := host
+			filter.Status = JobStatusFinished
+			list, _ := rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 2)
+
+			withErrors := true
+			filter.HasErrors = &withErrors
+			list, _ = rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 1)
+			So(list.Jobs[0].JobId, ShouldEqual, failed)
+		})
+
+		Convey("the indexes follow the status of the job", func() {
+			filter := host
+			filter.Status = JobStatusRunning
+			list, _ := rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 1)
+			So(list.Jobs[0].JobId, ShouldEqual, running)
+
+			rdata.CancelJob(running)
+			list, _ = rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 0)
+
+			filter.Status = JobStatusCancelled
+			withoutErrors := false
+			filter.HasErrors = &withoutErrors
+			list, _ = rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 1)
+			So(list.Jobs[0].JobId, ShouldEqual, running)
+		})
+
+		Convey("by start time", func() {
+			filter := host
+			filter.StartedAfter = time.Now().Add(time.Hour)
+			list, _ := rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 0)
+
+			filter.StartedAfter = time.Now().Add(-time.Hour)
+			filter.StartedBefore = time.Now().Add(time.Hour)
+			list, _ = rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 3)
+		})
+
+		Convey("paginated", func() {
+			filter := host
+			filter.Offset = 1
+			filter.Limit = 1
+			list, _ := rdata.Jobs(filter)
+			So(list.Total, ShouldEqual, 3)
+			So(len(list.Jobs), ShouldEqual, 1)
+			So(list.Jobs[0].JobId, ShouldEqual, failed)
+		})
+
+		Reset(func() {
+			for _, jobId := range []string{finished, failed, running} {
+				rdata.client.Del(scrapJobsKeyMeta(jobId))
+				rdata.client.ZRem(scrapJobsHostKey("jobs.example.com"), jobId)
+			}
+		})
+	})
+}
@@ -0,0 +1,211 @@
+package scraper
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	ErrInvalidUrlRules = fmt.Errorf("Invalid url rules, the host is required")
+
+	defaultUrlRules UrlRules
+)
+
+func init() {
+	UseUrlRules(UrlRules{
+		StripParams: []string{"sid", "utm_*", "gclid", "fbclid", "msclkid", "jsessionid", "phpsessid"},
+	})
+}
+
+// Rules to normalize the urls of a host, so the same product has always the same url.
+// The host is lowercased, the default port, the fragment and the trailing slash
+// are removed, and the query params are sorted
+type UrlRules struct {
+	Host string `json:"host,omitempty"`
+	// query and path params removed, a trailing * matches by prefix like utm_*
+	StripParams []string `json:"stripParams,omitempty"`
+	// when it is set only these query params are kept
+	KeepParams []string `json:"keepParams,omitempty"`
+	// the host serves the same page for any case of the path
+	LowercasePath     bool `json:"lowercasePath,omitempty"`
+	KeepTrailingSlash bool `json:"keepTrailingSlash,omitempty"`
+	KeepFragment      bool `json:"keepFragment,omitempty"`
+	// do not use the <link rel="canonical"> of the pages
+	IgnoreCanonical bool `json:"ignoreCanonical,omitempty"`
+}
+
+// default rules for all the hosts, the host rules are added to them
+func UseUrlRules(rules UrlRules) {
+	defaultUrlRules = rules
+}
+
+func validateUrlRules(rules UrlRules) error {
+	if rules.Host == "" {
+		return ErrInvalidUrlRules
+	}
+	return nil
+}
+
+// the params of the host are stripped besides the default ones
+func (rules UrlRules) merge(def UrlRules) UrlRules {
+	merged := rules
+	merged.StripParams = append(append([]string{}, def.StripParams...), rules.StripParams...)
+	if merged.KeepParams == nil {
+		merged.KeepParams = def.KeepParams
+	}
+	return merged
+}
+
+func (rules UrlRules) strip(param string) bool {
+	if len(rules.KeepParams) > 0 && !matchParam(rules.KeepParams, param) {
+		return true
+	}
+	return matchParam(rules.StripParams, param)
+}
+
+func matchParam(patterns []string, param string) bool {
+	param = strings.ToLower(param)
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(param, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizes the absolute url in place
+func (rules UrlRules) normalize(u *neturl.URL) {
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(u.Host, ":80")) || (u.Scheme == "https" && strings.HasSuffix(u.Host, ":443")) {
+		u.Host = u.Host[:strings.LastIndex(u.Host, ":")]
+	}
+
+	// path params like ;jsessionid=123
+	segments := strings.Split(u.Path, ";")
+	path := segments[0]
+	for _, segment := range segments[1:] {
+		name := strings.SplitN(segment, "=", 2)[0]
+		if !matchParam(rules.StripParams, name) {
+			path = path + ";" + segment
+		}
+	}
+	if rules.LowercasePath {
+		path = strings.ToLower(path)
+	}
+	if !rules.KeepTrailingSlash && len(path) > 1 {
+		path = strings.TrimRight(path, "/")
+	}
+	if path == "" && u.Host != "" {
+		path = "/"
+	}
+	u.Path = path
+	u.RawPath = ""
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for param := range q {
+			if rules.strip(param) {
+				q.Del(param)
+			}
+		}
+		// encoded sorted by key
+		u.RawQuery = q.Encode()
+	}
+
+	if !rules.KeepFragment {
+		u.Fragment = ""
+	}
+}
+
+// normalizes the urls found in a page, with the rules of the page host
+type urlNormalizer struct {
+	host  string
+	rules UrlRules
+}
+
+// normalizer for the page, the rules of the host are in Redis
+func urlNormalizerFor(pageUrl string) (urlNormalizer, error) {
+	u, err := neturl.Parse(pageUrl)
+	if err != nil {
+		return urlNormalizer{}, err
+	}
+	host := strings.ToLower(u.Host)
+
+	hostRules, err := NewRedisScrapdata().HostUrlRules(host)
+	if err != nil {
+		return urlNormalizer{}, err
+	}
+	return urlNormalizer{host: host, rules: hostRules.merge(defaultUrlRules)}, nil
+}
+
+// the urls of other hosts, like the images in a CDN, use the default rules
+func (n urlNormalizer) rulesFor(u *neturl.URL) UrlRules {
+	if n.host != "" && strings.EqualFold(u.Host, n.host) {
+		return n.rules
+	}
+	return defaultUrlRules
+}
+
+// absolute and normalized url, or the same url if it is not valid
+func (n urlNormalizer) normalize(base *neturl.URL, url string) string {
+	u, err := neturl.Parse(strings.Trim(url, " \t\r\n"))
+	if err != nil {
+		return url
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	n.rulesFor(u).normalize(u)
+	return u.String()
+}
+
+// url of the link found in the page, the page url if the link is empty
+func (n urlNormalizer) sanitize(pageUrl, url string, linkLimit int) string {
+	if url == "" {
+		return n.normalize(nil, pageUrl)
+	}
+
+	base, err := neturl.Parse(pageUrl)
+	if err != nil {
+		return url
+	}
+
+	purl, err := neturl.Parse(strings.Trim(url, " \t\r\n"))
+	if err != nil {
+		return url
+	}
+	purl.Path = strings.Replace(purl.Path, "sid=", "", -1)
+
+	if linkLimit != 0 {
+		path_parts := strings.Split(purl.Path, "/")
+		index := len(path_parts) - linkLimit
+		purl.Path = strings.Join(path_parts[0:index], "/")
+	}
+
+	return n.normalize(base, purl.String())
+}
+
+// canonical url declared by the page, or the page url
+func (n urlNormalizer) canonical(doc *goquery.Document, pageUrl string) string {
+	base, err := neturl.Parse(pageUrl)
+	if err != nil {
+		return pageUrl
+	}
+	if n.rulesFor(base).IgnoreCanonical {
+		return n.normalize(nil, pageUrl)
+	}
+
+	href, ok := doc.Find(`link[rel="canonical"]`).First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return n.normalize(nil, pageUrl)
+	}
+	return n.normalize(base, href)
+}
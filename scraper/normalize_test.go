@@ -0,0 +1,97 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	Convey("The urls of the same product are normalized to one url", t, func() {
+		n := urlNormalizer{}
+		page := "http://www.shop.com/list/shoes"
+
+		Convey("tracking and session params are removed and the query is sorted", func() {
+			link := "/p/123?utm_source=mail&size=9&color=red&UTM_Campaign=x&gclid=abc"
+			So(n.sanitize(page, link, 0), ShouldEqual, "http://www.shop.com/p/123?color=red&size=9")
+		})
+
+		Convey("host case, default port, fragment and trailing slash", func() {
+			So(n.sanitize(page, "HTTP://WWW.Shop.com:80/p/123/#reviews", 0), ShouldEqual, "http://www.shop.com/p/123")
+			So(n.sanitize(page, "https://www.shop.com:443/", 0), ShouldEqual, "https://www.shop.com/")
+		})
+
+		Convey("path params with the session", func() {
+			So(n.sanitize(page, "/p/123;jsessionid=A1B2C3", 0), ShouldEqual, "http://www.shop.com/p/123")
+		})
+
+		Convey("relative links are resolved from the page", func() {
+			So(n.sanitize(page, "123", 0), ShouldEqual, "http://www.shop.com/list/123")
+			So(n.sanitize(page, "../p/123", 0), ShouldEqual, "http://www.shop.com/p/123")
+		})
+
+		Convey("the rules of the host", func() {
+			n = urlNormalizer{host: "www.shop.com", rules: UrlRules{
+				Host:          "www.shop.com",
+				KeepParams:    []string{"id"},
+				LowercasePath: true,
+			}.merge(defaultUrlRules)}
+
+			So(n.sanitize(page, "/Product.php?id=12&ref=home&sort=asc", 0), ShouldEqual, "http://www.shop.com/product.php?id=12")
+			// other hosts use the default rules
+			So(n.sanitize(page, "http://cdn.shop.com/IMG.jpg?v=2", 0), ShouldEqual, "http://cdn.shop.com/IMG.jpg?v=2")
+		})
+	})
+
+	Convey("The items use the canonical url and the rules saved for the host", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`<html><head><link rel="canonical" href="/p/123"></head><body>
+				<div class="product"><h1>Test</h1><a class="shop" href="/shop/?ref=detail&id=7">shop</a></div>
+			</body></html>`))
+		}))
+		defer ts.Close()
+
+		u, _ := neturl.Parse(ts.URL)
+		rdata := NewRedisScrapdata()
+		err := rdata.SaveHostUrlRules(UrlRules{Host: u.Host, StripParams: []string{"ref"}})
+		So(err, ShouldBeNil)
+		defer rdata.DeleteHostUrlRules(u.Host)
+
+		rules, err := rdata.HostUrlRules(u.Host)
+		So(err, ShouldBeNil)
+		So(rules.StripParams, ShouldResemble, []string{"ref"})
+
+		So(rdata.SaveHostUrlRules(UrlRules{}), ShouldEqual, ErrInvalidUrlRules)
+
+		s := ScrapSelector{
+			Url:   ts.URL + "/p/123?utm_source=feed#top",
+			Stype: SelectorTypeDetail,
+			Base:  ".product",
+			Title: Selector{Exp: "h1"},
+		}
+		_, items, err := NewScrapper().Scrap(context.Background(), s)
+		So(err, ShouldBeNil)
+
+		count := 0
+		for it := range items {
+			count++
+			So(it.Item.ScrapUrl, ShouldEqual, ts.URL+"/p/123")
+			So(it.Item.CanonicalUrl, ShouldEqual, ts.URL+"/p/123")
+			So(it.Item.Link, ShouldEqual, ts.URL+"/p/123")
+		}
+		So(count, ShouldEqual, 1)
+
+		Convey("the links use the rules of the host", func() {
+			s.Link = Selector{Exp: "a.shop", Attr: "href"}
+			_, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			for it := range items {
+				So(it.Item.Link, ShouldEqual, ts.URL+"/shop?id=7")
+			}
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var (
+	// cause of the context of a paused job
+	errJobPaused = errors.New("Scrap job paused")
+)
+
+// Pauses a running job, it stops fetching new pages and the pages and recursive
+// links not scraped yet are kept in Redis until the job is resumed
+func PauseJob(jobId string) error {
+	err := NewRedisScrapdata().PauseJob(jobId)
+	if err != nil {
+		return err
+	}
+
+	stopJob(jobId, errJobPaused)
+	return nil
+}
+
+// Resumes a paused job with its pending pages, also after a restart of the
+// process. The items are sent with the jobId of the paused job
+func ResumeJob(jobId string) (chan ItemResult, error) {
+	data := NewRedisScrapdata()
+	err := data.ResumeJob(jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := data.PendingPages(jobId)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: Scrap [%s] resumed with %d pending pages\n", jobId, len(pages))
+	return scrapPages(context.Background(), jobId, pages), nil
+}
+
+// Scraps the pages in a new job, the selector describes the job
+func ScrapPages(ctx context.Context, jobId string, selector ScrapSelector, pages []ScrapSelector) chan ItemResult {
+	data := NewRedisScrapdata()
+	data.StartJob(jobId, selector)
+	for i, _ := range pages {
+		data.AddPendingPage(jobId, pendingPage(pages[i]))
+	}
+
+	log.Printf("INFO: Scrap [%s] started with %d pages\n", jobId, len(pages))
+	return scrapPages(ctx, jobId, pages)
+}
+
+func scrapPages(ctx context.Context, jobId string, pages []ScrapSelector) chan ItemResult {
+	ctx = jobContext(ctx, jobId)
+	items := make(chan ItemResult, bufferItemsSize)
+	wg := &sync.WaitGroup{}
+
+	wg.Add(len(pages))
+	for i, _ := range pages {
+		// the list pages of a recursive job follow their items
+		if pages[i].Recursive {
+			go scrapRecursivePage(ctx, jobId, pages[i], items, wg)
+			continue
+		}
+		go doScrapFromUrl(ctx, jobId, pages[i], items, wg)
+	}
+
+	go closeItemsChannel(ctx, jobId, items, wg)
+
+	return items
+}
+
+func scrapRecursivePage(ctx context.Context, jobId string, s ScrapSelector, items chan ItemResult, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	_, pageItems, err := NewRecursiveScrapper().Scrap(ctx, s)
+	if err != nil {
+		log.Printf("ERROR: Scrap [%s] recursive page %v with message %v", jobId, s.Url, err.Error())
+		return
+	}
+	for it := range pageItems {
+		it.JobId = jobId
+		sendItem(ctx, items, it)
+	}
+}
+
+// the page as it is kept pending, one selector for every page
+func pendingPage(s ScrapSelector) ScrapSelector {
+	dup := s
+	dup.PageParam = ""
+	return dup
+}
+
+// the job was paused or cancelled, in this process or in another one
+func jobStopped(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return true
+	}
+	root := jobRoot(ctx)
+	if root == "" {
+		return false
+	}
+	status, _ := NewRedisScrapdata().JobStatus(root)
+	return status == JobStatusPaused || status == JobStatusCancelled
+}
@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPauseJob(t *testing.T) {
+	Convey("A paused job keeps its pending pages until it is resumed", t, func() {
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			// only the first page is served until the release
+			if r.URL.Query().Get("page") != "1" {
+				select {
+				case <-release:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			w.Write([]byte(`<html><body><div class="product"><h2>Test</h2></div><div class="product"><h2>Test</h2></div></body></html>`))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:       ts.URL + "/list",
+			Base:      ".product",
+			Title:     Selector{Exp: "h2"},
+			PageParam: "page",
+			PageStart: 1,
+			PageIncr:  1,
+			PageLimit: 5,
+		}
+		rdata := NewRedisScrapdata()
+
+		jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+		So(err, ShouldBeNil)
+
+		// the first page is scraped before the pause
+		<-items
+		time.Sleep(50 * time.Millisecond)
+		So(PauseJob(jobId), ShouldBeNil)
+		So(drainItems(items, time.Second), ShouldEqual, 1)
+
+		status, _ := rdata.JobStatus(jobId)
+		So(status, ShouldEqual, JobStatusPaused)
+		pages, err := rdata.PendingPages(jobId)
+		So(err, ShouldBeNil)
+		So(len(pages), ShouldEqual, 3)
+		for _, p := range pages {
+			So(p.PageParam, ShouldEqual, "")
+			So(p.Url, ShouldNotContainSubstring, "page=1")
+		}
+		job, _ := rdata.ScrapJob(jobId)
+		So(job["pending"], ShouldEqual, 3)
+		So(job["meta"].(map[string]string)["finish"], ShouldEqual, "")
+
+		So(PauseJob(jobId), ShouldEqual, ErrJobNotRunning)
+
+		Convey("the job continues with the pending pages", func() {
+			close(release)
+			resumed, err := ResumeJob(jobId)
+			So(err, ShouldBeNil)
+
+			count := 0
+			for it := range resumed {
+				So(it.JobId, ShouldEqual, jobId)
+				count++
+			}
+			So(count, ShouldEqual, 6)
+
+			status, _ := rdata.JobStatus(jobId)
+			So(status, ShouldEqual, JobStatusFinished)
+			pages, _ := rdata.PendingPages(jobId)
+			So(len(pages), ShouldEqual, 0)
+
+			_, err = ResumeJob(jobId)
+			So(err, ShouldEqual, ErrJobNotPaused)
+		})
+
+		Convey("the paused job can be cancelled", func() {
+			defer close(release)
+			So(CancelJob(jobId), ShouldBeNil)
+
+			status, _ := rdata.JobStatus(jobId)
+			So(status, ShouldEqual, JobStatusCancelled)
+			pages, _ := rdata.PendingPages(jobId)
+			So(len(pages), ShouldEqual, 0)
+		})
+	})
+
+	Convey("A job resumed while the paused run is stopping", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`<html><body><div class="product"><h2>Test</h2></div><div class="product"><h2>Test</h2></div></body></html>`))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:        ts.URL + "/list",
+			Base:       ".product",
+			Title:      Selector{Exp: "h2"},
+			PageParam:  "page",
+			PageStart:  1,
+			PageIncr:   1,
+			PageLimit:  20,
+			Politeness: &Politeness{RatePerSecond: 20, Burst: 1},
+		}
+
+		jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+		So(err, ShouldBeNil)
+		<-items
+		So(PauseJob(jobId), ShouldBeNil)
+		resumed, err := ResumeJob(jobId)
+		So(err, ShouldBeNil)
+		So(drainItems(items, time.Second), ShouldBeGreaterThanOrEqualTo, 0)
+
+		count := drainItems(resumed, 3*time.Second)
+		So(count, ShouldBeGreaterThan, 0)
+		So(waitJob(jobId, time.Second), ShouldEqual, JobStatusFinished)
+		pages, _ := NewRedisScrapdata().PendingPages(jobId)
+		So(len(pages), ShouldEqual, 0)
+		job, _ := NewRedisScrapdata().ScrapJob(jobId)
+		So(job["meta"].(map[string]string)["errors"], ShouldEqual, "")
+	})
+
+	Convey("Unknown jobs can not be paused", t, func() {
+		So(PauseJob("D-unknown"), ShouldEqual, ErrJobNotFound)
+		_, err := ResumeJob("D-unknown")
+		So(err, ShouldEqual, ErrJobNotFound)
+	})
+}
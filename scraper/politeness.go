@@ -0,0 +1,124 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"time"
+)
+
+const (
+	// a slot of a host is freed after the lease if the instance dies
+	hostSlotLease = 2 * time.Minute
+	hostSlotPoll  = 10 * time.Millisecond
+)
+
+var (
+	ErrInvalidPoliteness = fmt.Errorf("InvalidPoliteness it needs a host, and the limits can not be negative")
+
+	defaultPoliteness Politeness
+)
+
+func init() {
+	UsePoliteness(Politeness{RatePerSecond: 5, Burst: 5, MaxInFlight: 4})
+}
+
+// Limits for the requests to a host, zero values are taken from the defaults
+type Politeness struct {
+	Host string `json:"host,omitempty"`
+	// token bucket, requests per second and the maximun burst
+	RatePerSecond float64 `json:"ratePerSecond,omitempty"`
+	Burst         int     `json:"burst,omitempty"`
+	// maximun number of concurrent requests
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// default limits for every host
+func UsePoliteness(p Politeness) {
+	defaultPoliteness = p
+}
+
+// the limits that are not set are taken from base
+func (p Politeness) merge(base Politeness) Politeness {
+	merged := base
+	if p.RatePerSecond > 0 {
+		merged.RatePerSecond = p.RatePerSecond
+	}
+	if p.Burst > 0 {
+		merged.Burst = p.Burst
+	}
+	if p.MaxInFlight > 0 {
+		merged.MaxInFlight = p.MaxInFlight
+	}
+	return merged
+}
+
+func validatePoliteness(p Politeness) error {
+	if p.Host == "" || p.RatePerSecond < 0 || p.Burst < 0 || p.MaxInFlight < 0 {
+		return ErrInvalidPoliteness
+	}
+	return nil
+}
+
+// limits for the selector: selector, then host, then defaults
+func politenessFor(selector ScrapSelector) (Politeness, error) {
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return Politeness{}, err
+	}
+
+	p := defaultPoliteness
+	hostPoliteness, err := NewRedisScrapdata().HostPoliteness(u.Host)
+	if err != nil {
+		return p, err
+	}
+	p = hostPoliteness.merge(p)
+	if selector.Politeness != nil {
+		p = selector.Politeness.merge(p)
+	}
+	p.Host = u.Host
+
+	return p, nil
+}
+
+// waits until the host accepts one more request, and returns the function to
+// release it. The slots and the rate are kept in Redis, shared by all the jobs
+// and the instances hitting the same host. It stops waiting when the context is done
+func acquireHost(ctx context.Context, p Politeness) (func(), error) {
+	data := NewRedisScrapdata()
+
+	release := func() {}
+	if p.MaxInFlight > 0 {
+		token := newUlid(time.Now())
+		for {
+			slot, err := data.AcquireHostSlot(p.Host, p.MaxInFlight, token, hostSlotLease)
+			if err != nil {
+				return nil, err
+			}
+			if slot >= 0 {
+				release = func() { data.ReleaseHostSlot(p.Host, slot, token) }
+				break
+			}
+			select {
+			case <-time.After(hostSlotPoll):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	if p.RatePerSecond > 0 {
+		wait, err := data.ReserveHostRate(p.Host, p.RatePerSecond, p.Burst)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,162 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPolitenessMerge(t *testing.T) {
+	Convey("Selector limits over host limits over defaults", t, func() {
+		base := Politeness{RatePerSecond: 5, Burst: 5, MaxInFlight: 4}
+		host := Politeness{Host: "shop", RatePerSecond: 1}
+		selector := Politeness{MaxInFlight: 1}
+
+		p := selector.merge(host.merge(base))
+		So(p.RatePerSecond, ShouldEqual, 1)
+		So(p.Burst, ShouldEqual, 5)
+		So(p.MaxInFlight, ShouldEqual, 1)
+	})
+}
+
+func TestHostLimiterRate(t *testing.T) {
+	Convey("The rate limits the requests per second", t, func() {
+		p := Politeness{Host: NewJobId("rate.") + ".com", RatePerSecond: 20, Burst: 1}
+
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			release, err := acquireHost(context.Background(), p)
+			So(err, ShouldBeNil)
+			release()
+		}
+		// first request is free, the other 4 wait 50ms each
+		So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 180*time.Millisecond)
+	})
+
+	Convey("The burst is taken ahead of the rate", t, func() {
+		rdata := NewRedisScrapdata()
+		host := NewJobId("burst.") + ".com"
+		for i := 0; i < 3; i++ {
+			wait, err := rdata.ReserveHostRate(host, 1, 3)
+			So(err, ShouldBeNil)
+			So(wait, ShouldEqual, 0)
+		}
+		wait, _ := rdata.ReserveHostRate(host, 1, 3)
+		So(wait, ShouldBeGreaterThan, 900*time.Millisecond)
+	})
+
+	Convey("The slots of a host are shared through Redis", t, func() {
+		rdata := NewRedisScrapdata()
+		host := NewJobId("slots.") + ".com"
+
+		// other instance holds the only slot
+		slot, err := rdata.AcquireHostSlot(host, 1, "other", time.Minute)
+		So(err, ShouldBeNil)
+		So(slot, ShouldEqual, 0)
+
+		acquired := make(chan struct{})
+		go func() {
+			release, _ := acquireHost(context.Background(), Politeness{Host: host, MaxInFlight: 1})
+			close(acquired)
+			release()
+		}()
+
+		select {
+		case <-acquired:
+			t.Error("slot acquired while other instance holds it")
+		case <-time.After(50 * time.Millisecond):
+		}
+		rdata.ReleaseHostSlot(host, 0, "other")
+		So(waitClosed(acquired, time.Second), ShouldBeTrue)
+	})
+}
+
+func TestHostWaitsCancelled(t *testing.T) {
+	Convey("A cancelled job stops waiting for the host", t, func() {
+		rdata := NewRedisScrapdata()
+		host := NewJobId("busy.") + ".com"
+		rdata.AcquireHostSlot(host, 1, "other", time.Minute)
+		defer rdata.ReleaseHostSlot(host, 0, "other")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+
+		Convey("for a slot", func() {
+			_, err := acquireHost(ctx, Politeness{Host: host, MaxInFlight: 1})
+			So(err, ShouldEqual, context.DeadlineExceeded)
+		})
+
+		Convey("for the rate", func() {
+			rdata.ReserveHostRate(host, 0.1, 1)
+			_, err := acquireHost(ctx, Politeness{Host: host, RatePerSecond: 0.1, Burst: 1})
+			So(err, ShouldEqual, context.DeadlineExceeded)
+		})
+
+		Convey("for the crawl delay", func() {
+			waitCrawlDelay(context.Background(), host, 10*time.Second)
+			So(waitCrawlDelay(ctx, host, 10*time.Second), ShouldEqual, context.DeadlineExceeded)
+		})
+
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
+
+func waitClosed(c chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-c:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestScrapMaxInFlightPerHost(t *testing.T) {
+	Convey("Paginated scrap does not exceed the requests in flight for the host", t, func() {
+		var mu sync.Mutex
+		inFlight, maxSeen := 0, 0
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			inFlight++
+			if inFlight > maxSeen {
+				maxSeen = inFlight
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+			w.Write([]byte(example1))
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:        ts.URL + "/list?page=0",
+			Base:       ".product-info",
+			Id:         Selector{Exp: "h2[id]", Attr: "id"},
+			PageParam:  "page",
+			PageStart:  0,
+			PageIncr:   1,
+			PageLimit:  8,
+			Politeness: &Politeness{RatePerSecond: 1000, Burst: 1000, MaxInFlight: 2},
+		}
+
+		_, items, err := NewScrapper().Scrap(context.Background(), s)
+		So(err, ShouldBeNil)
+
+		count := 0
+		for _ = range items {
+			count++
+		}
+		So(count, ShouldEqual, 16)
+		So(maxSeen, ShouldBeLessThanOrEqualTo, 2)
+	})
+}
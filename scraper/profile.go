@@ -0,0 +1,194 @@
+package scraper
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"sync"
+)
+
+const (
+	DefaultHeaderProfile = "default"
+
+	// only the default profile, one profile per host, or a random profile per request
+	ProfileRotationNone    = "none"
+	ProfileRotationHost    = "host"
+	ProfileRotationRequest = "request"
+)
+
+var (
+	ErrInvalidHeaderProfile = fmt.Errorf("InvalidHeaderProfile it needs a name and a User-Agent")
+	ErrHeaderProfileUnknown = fmt.Errorf("InvalidHeaderProfile the profile does not exist")
+
+	headerProfiles   = map[string]HeaderProfile{}
+	headerProfilesMu sync.RWMutex
+
+	profileRotation = ProfileRotationNone
+)
+
+func init() {
+	UseHeaderProfile(HeaderProfile{
+		Name:           "chrome",
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+		AcceptLanguage: "en-GB,en;q=0.9",
+		AcceptEncoding: acceptEncoding,
+	})
+	UseHeaderProfile(HeaderProfile{
+		Name:           "firefox",
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-GB,en;q=0.5",
+		AcceptEncoding: acceptEncoding,
+	})
+	UseHeaderProfile(HeaderProfile{
+		Name:           "mobile",
+		UserAgent:      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-GB,en;q=0.9",
+		AcceptEncoding: acceptEncoding,
+	})
+}
+
+// Headers sent to look like a browser, the empty ones are not sent
+type HeaderProfile struct {
+	Name           string            `json:"name"`
+	UserAgent      string            `json:"userAgent"`
+	Accept         string            `json:"accept,omitempty"`
+	AcceptLanguage string            `json:"acceptLanguage,omitempty"`
+	AcceptEncoding string            `json:"acceptEncoding,omitempty"`
+	Headers        map[string]string `json:"headers,omitempty"`
+}
+
+// Profile pinned to a host for all the selectors
+type HostProfile struct {
+	Host    string `json:"host"`
+	Profile string `json:"profile"`
+}
+
+// registers or replaces a header profile
+func UseHeaderProfile(p HeaderProfile) error {
+	if p.Name == "" || p.UserAgent == "" {
+		return ErrInvalidHeaderProfile
+	}
+
+	headerProfilesMu.Lock()
+	defer headerProfilesMu.Unlock()
+	headerProfiles[p.Name] = p
+	return nil
+}
+
+// how to rotate the profiles of the selectors without one pinned
+func UseProfileRotation(rotation string) {
+	profileRotation = rotation
+}
+
+// all the registered profiles sorted by name
+func HeaderProfiles() []HeaderProfile {
+	headerProfilesMu.RLock()
+	defer headerProfilesMu.RUnlock()
+
+	var profiles []HeaderProfile
+	for _, p := range headerProfiles {
+		profiles = append(profiles, p)
+	}
+	sort.Sort(byProfileName(profiles))
+	return profiles
+}
+
+func headerProfile(name string) (HeaderProfile, bool) {
+	headerProfilesMu.RLock()
+	defer headerProfilesMu.RUnlock()
+	p, ok := headerProfiles[name]
+	return p, ok
+}
+
+func validateHostProfile(hp HostProfile) error {
+	if hp.Host == "" {
+		return ErrInvalidHeaderProfile
+	}
+	if _, ok := headerProfile(hp.Profile); !ok {
+		return ErrHeaderProfileUnknown
+	}
+	return nil
+}
+
+// profile for the selector: selector, then host, then rotation
+func headerProfileFor(selector ScrapSelector) (HeaderProfile, error) {
+	if selector.Profile != "" {
+		p, ok := headerProfile(selector.Profile)
+		if !ok {
+			return p, ErrHeaderProfileUnknown
+		}
+		return p, nil
+	}
+
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return HeaderProfile{}, err
+	}
+
+	pinned, err := NewRedisScrapdata().HostProfile(u.Host)
+	if err != nil {
+		return HeaderProfile{}, err
+	}
+	if p, ok := headerProfile(pinned); ok {
+		return p, nil
+	}
+
+	return rotateProfile(u.Host), nil
+}
+
+func rotateProfile(host string) HeaderProfile {
+	if profileRotation == ProfileRotationNone {
+		p, _ := headerProfile(DefaultHeaderProfile)
+		return p
+	}
+
+	profiles := HeaderProfiles()
+	if profileRotation == ProfileRotationHost {
+		h := fnv.New32a()
+		h.Write([]byte(host))
+		return profiles[int(h.Sum32()%uint32(len(profiles)))]
+	}
+	return profiles[rand.Intn(len(profiles))]
+}
+
+// the selector with its profile pinned, so all the attempts of a page
+// use the same profile and the items record it
+func withHeaderProfile(selector ScrapSelector) (ScrapSelector, error) {
+	p, err := headerProfileFor(selector)
+	if err != nil {
+		return selector, err
+	}
+	selector.Profile = p.Name
+	return selector, nil
+}
+
+func (p HeaderProfile) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", p.UserAgent)
+	if p.Accept != "" {
+		req.Header.Set("Accept", p.Accept)
+	}
+	if p.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", p.AcceptLanguage)
+	}
+	// with an explicit Accept-Encoding the transport does not decompress, see decodeBody
+	if p.AcceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", p.AcceptEncoding)
+	} else {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	for k, v := range p.Headers {
+		req.Header.Set(k, v)
+	}
+}
+
+type byProfileName []HeaderProfile
+
+func (a byProfileName) Len() int           { return len(a) }
+func (a byProfileName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byProfileName) Less(i, j int) bool { return a[i].Name < a[j].Name }
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHeaderProfiles(t *testing.T) {
+	Convey("Requests are sent with the headers of the profile", t, func() {
+		var userAgent, language string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			userAgent = r.Header.Get("User-Agent")
+			language = r.Header.Get("Accept-Language")
+
+			if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+				w.Header().Set("Content-Encoding", "gzip")
+				gz := gzip.NewWriter(w)
+				gz.Write([]byte(example1))
+				gz.Close()
+				return
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		u, _ := neturl.Parse(ts.URL)
+		rdata := NewRedisScrapdata()
+		defer rdata.DeleteHostProfile(u.Host)
+
+		s := ScrapSelector{
+			Url:   ts.URL + "/list.html",
+			Base:  ".product-info",
+			Title: Selector{Exp: "h2"},
+		}
+
+		Convey("the default profile", func() {
+			_, err := SnippetBase(s)
+			So(err, ShouldBeNil)
+			So(userAgent, ShouldEqual, defaultUserAgent)
+			So(language, ShouldEqual, "")
+		})
+
+		Convey("a profile pinned by the selector is recorded in the items", func() {
+			s.Profile = "firefox"
+			_, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			count := 0
+			for it := range items {
+				So(it.Profile, ShouldEqual, "firefox")
+				So(it.Item.Title, ShouldNotEqual, "")
+				count++
+			}
+			So(count, ShouldBeGreaterThan, 0)
+			So(userAgent, ShouldContainSubstring, "Firefox")
+			So(language, ShouldEqual, "en-GB,en;q=0.5")
+		})
+
+		Convey("a profile pinned to the host", func() {
+			err := rdata.SaveHostProfile(HostProfile{Host: u.Host, Profile: "mobile"})
+			So(err, ShouldBeNil)
+
+			_, err = SnippetBase(s)
+			So(err, ShouldBeNil)
+			So(userAgent, ShouldContainSubstring, "iPhone")
+
+			Convey("the selector wins over the host", func() {
+				s.Profile = "chrome"
+				_, err = SnippetBase(s)
+				So(err, ShouldBeNil)
+				So(userAgent, ShouldContainSubstring, "Chrome")
+			})
+		})
+
+		Convey("unknown profiles are rejected", func() {
+			err := rdata.SaveHostProfile(HostProfile{Host: u.Host, Profile: "netscape"})
+			So(err, ShouldEqual, ErrHeaderProfileUnknown)
+
+			s.Profile = "netscape"
+			_, err = SnippetBase(s)
+			So(err, ShouldEqual, ErrHeaderProfileUnknown)
+		})
+
+		Convey("rotation per host always picks the same profile", func() {
+			UseProfileRotation(ProfileRotationHost)
+			defer UseProfileRotation(ProfileRotationNone)
+
+			first := rotateProfile("www.example.com")
+			for i := 0; i < 5; i++ {
+				So(rotateProfile("www.example.com").Name, ShouldEqual, first.Name)
+			}
+		})
+	})
+}
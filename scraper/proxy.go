@@ -0,0 +1,290 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultProxyPool = "default"
+	// selector value to skip the proxies
+	ProxyPoolDirect = "direct"
+
+	// one proxy per host shared by all the jobs, or a proxy per request
+	ProxyStickyHost    = "host"
+	ProxyStickyRequest = "request"
+
+	// proxies with a lower score are used only if there are no others
+	proxyMinScore = 0.3
+)
+
+var (
+	ErrInvalidProxyPool = fmt.Errorf("InvalidProxyPool it needs proxies with http, https or socks5 scheme")
+
+	proxyPools   = map[string]*ProxyPool{}
+	proxyPoolsMu sync.RWMutex
+
+	// one client per proxy, the transports keep the connections
+	proxyClients   = map[string]*http.Client{}
+	proxyClientsMu sync.Mutex
+
+	credentialsInUrl = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]+):[^@/\s]*@`)
+)
+
+// Pool of http or socks5 proxies
+type ProxyPool struct {
+	Name    string
+	Sticky  string
+	proxies []*neturl.URL
+}
+
+// Health of a proxy, the score goes from 0 to 1
+type ProxyHealth struct {
+	Proxy     string  `json:"proxy"`
+	Requests  int     `json:"requests"`
+	Failures  int     `json:"failures"`
+	Score     float64 `json:"score"`
+	LastError string  `json:"lastError,omitempty"`
+	LastUsed  string  `json:"lastUsed,omitempty"`
+}
+
+// proxy used for a request
+type proxyChoice struct {
+	pool   *ProxyPool
+	proxy  *neturl.URL
+	host   string
+	client *http.Client
+}
+
+// registers a pool of proxies, sticky is ProxyStickyHost or ProxyStickyRequest
+func UseProxyPool(name string, proxies []string, sticky string) error {
+	pool := &ProxyPool{Name: name, Sticky: sticky}
+	if pool.Sticky == "" {
+		pool.Sticky = ProxyStickyHost
+	}
+
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		u, err := neturl.Parse(p)
+		if err != nil {
+			return ErrInvalidProxyPool
+		}
+		if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+			return ErrInvalidProxyPool
+		}
+		pool.proxies = append(pool.proxies, u)
+	}
+
+	proxyPoolsMu.Lock()
+	defer proxyPoolsMu.Unlock()
+
+	if len(pool.proxies) == 0 {
+		delete(proxyPools, name)
+		return nil
+	}
+	proxyPools[name] = pool
+	return nil
+}
+
+func proxyPool(name string) *ProxyPool {
+	proxyPoolsMu.RLock()
+	defer proxyPoolsMu.RUnlock()
+	return proxyPools[name]
+}
+
+// all the registered pools
+func ProxyPools() []*ProxyPool {
+	proxyPoolsMu.RLock()
+	defer proxyPoolsMu.RUnlock()
+
+	var pools []*ProxyPool
+	for _, p := range proxyPools {
+		pools = append(pools, p)
+	}
+	return pools
+}
+
+// the proxies of the pool with the credentials redacted
+func (p *ProxyPool) Proxies() []string {
+	var proxies []string
+	for _, u := range p.proxies {
+		proxies = append(proxies, proxyId(u))
+	}
+	return proxies
+}
+
+// proxy url without the password, used as id in logs, Redis and the job meta
+func proxyId(u *neturl.URL) string {
+	return redactCredentials(u.String())
+}
+
+// hides the password of every url in the string
+func redactCredentials(s string) string {
+	return credentialsInUrl.ReplaceAllString(s, "$1:"+redactedValue+"@")
+}
+
+// the client to fetch the selector, through a proxy if the selector uses a pool
+func clientFor(selector ScrapSelector) (*proxyChoice, error) {
+	name := selector.ProxyPool
+	if name == ProxyPoolDirect {
+		return &proxyChoice{client: httpClient()}, nil
+	}
+	if name == "" {
+		name = DefaultProxyPool
+	}
+
+	pool := proxyPool(name)
+	if pool == nil {
+		if selector.ProxyPool != "" {
+			return nil, fmt.Errorf("Proxy pool %s not found", selector.ProxyPool)
+		}
+		return &proxyChoice{client: httpClient()}, nil
+	}
+
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := pool.choose(u.Host)
+	return &proxyChoice{
+		pool:   pool,
+		proxy:  proxy,
+		host:   u.Host,
+		client: proxyClient(proxy),
+	}, nil
+}
+
+// the proxy for the host, a session always sticks to the same proxy
+func (p *ProxyPool) choose(host string) *neturl.URL {
+	rdata := NewRedisScrapdata()
+
+	sticky := p.Sticky == ProxyStickyHost
+	if !sticky {
+		session, _ := sessionFor("//" + host)
+		sticky = session != nil
+	}
+
+	if sticky {
+		assigned := rdata.ProxyAssignment(p.Name, host)
+		for _, u := range p.proxies {
+			if proxyId(u) == assigned {
+				return u
+			}
+		}
+	}
+
+	proxy := p.healthiest(rdata)
+	if sticky {
+		rdata.SaveProxyAssignment(p.Name, host, proxyId(proxy))
+	}
+	return proxy
+}
+
+// random proxy from the healthy ones, or the best one if none is healthy
+func (p *ProxyPool) healthiest(rdata *RedisScrapdata) *neturl.URL {
+	var healthy []*neturl.URL
+	var best *neturl.URL
+	bestScore := -1.0
+
+	for _, u := range p.proxies {
+		h := rdata.ProxyHealth(proxyId(u))
+		if h.Score >= proxyMinScore {
+			healthy = append(healthy, u)
+		}
+		if h.Score > bestScore {
+			best = u
+			bestScore = h.Score
+		}
+	}
+
+	if len(healthy) == 0 {
+		return best
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// records the result of the request, a failure rotates the host to other proxy
+func (c *proxyChoice) done(err error) {
+	if c.proxy == nil {
+		return
+	}
+
+	id := proxyId(c.proxy)
+	rdata := NewRedisScrapdata()
+
+	failed := proxyFailure(err)
+	msg := ""
+	if failed {
+		msg = redactCredentials(err.Error())
+		log.Printf("ERROR: Proxy %s failed for %s with message %v", id, c.host, msg)
+		rdata.DeleteProxyAssignment(c.pool.Name, c.host)
+	}
+	rdata.SaveProxyResult(id, !failed, msg, time.Now())
+}
+
+// network errors and block responses count against the proxy, not the
+// requests aborted by a stopped job
+func proxyFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if _, ok := err.(*neturl.Error); ok {
+		return true
+	}
+	fe, ok := err.(FetchError)
+	if !ok {
+		return false
+	}
+	if fe.Kind == FetchErrorBlocked {
+		return true
+	}
+	return fe.Kind == FetchErrorStatus && (fe.StatusCode == 403 || fe.StatusCode == 407 || fe.StatusCode == 429)
+}
+
+func resetProxyClients() {
+	proxyClientsMu.Lock()
+	defer proxyClientsMu.Unlock()
+	proxyClients = map[string]*http.Client{}
+}
+
+// a copy of the default client going through the proxy
+func proxyClient(proxy *neturl.URL) *http.Client {
+	key := proxy.String()
+
+	proxyClientsMu.Lock()
+	defer proxyClientsMu.Unlock()
+
+	client, ok := proxyClients[key]
+	if ok {
+		return client
+	}
+
+	base := httpClient()
+	c := *base
+	transport, ok := base.Transport.(*http.Transport)
+	if !ok || transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	t := transport.Clone()
+	t.Proxy = http.ProxyURL(proxy)
+	c.Transport = t
+
+	proxyClients[key] = &c
+	return &c
+}
@@ -0,0 +1,131 @@
+package scraper
+
+import (
+	"log"
+)
+
+var (
+	// the jobs are queued in redis and scraped by the workers
+	jobQueue bool
+	// times a unit is leased before it is given up
+	queueMaxAttempts int
+)
+
+func init() {
+	UseJobQueue(false)
+	UseQueueMaxAttempts(3)
+}
+
+// the API queues the jobs for the worker processes instead of scraping them
+func UseJobQueue(enabled bool) {
+	jobQueue = enabled
+}
+
+func UseQueueMaxAttempts(attempts int) {
+	queueMaxAttempts = attempts
+}
+
+// Unit of work of a queued job, the fetch of a page. The list pages of a
+// recursive job queue the detail pages of their items
+type QueueUnit struct {
+	Id       string        `json:"id"`
+	JobId    string        `json:"jobId"`
+	Selector ScrapSelector `json:"selector"`
+	// times the unit has been leased without being acked
+	Attempts int `json:"attempts"`
+}
+
+// Starts a job with a unit for every page in the queue, it returns the jobId
+func EnqueueJob(selector ScrapSelector) (string, error) {
+	selector, err := RecursiveScrapper{}.selectorFromRedis(selector)
+	if err != nil {
+		return "", err
+	}
+
+	err = validateSelector(selector)
+	if err != nil {
+		return "", err
+	}
+
+	jobId := NewJobId("D")
+	if selector.Recursive {
+		jobId = NewJobId("R")
+	}
+
+	return jobId, EnqueuePages(jobId, selector, paginatedUrlSelector(selector))
+}
+
+// Starts a job with a unit for every page, the selector describes the job
+func EnqueuePages(jobId string, selector ScrapSelector, pages []ScrapSelector) error {
+	data := NewRedisScrapdata()
+	data.StartJob(jobId, selector)
+
+	for i, _ := range pages {
+		_, err := data.EnqueueUnit(QueueUnit{JobId: jobId, Selector: pages[i]})
+		if err != nil {
+			return err
+		}
+	}
+	if len(pages) == 0 {
+		data.FinishJob(jobId)
+	}
+
+	log.Printf("INFO: Scrap [%s] queued with %d pages\n", jobId, len(pages))
+	return nil
+}
+
+// Resumes a paused job queueing its pending pages
+func EnqueueResumedJob(jobId string) error {
+	data := NewRedisScrapdata()
+	err := data.ResumeJob(jobId)
+	if err != nil {
+		return err
+	}
+
+	pages, err := data.PendingPages(jobId)
+	if err != nil {
+		return err
+	}
+
+	queued := 0
+	for i, _ := range pages {
+		added, err := data.EnqueueUnit(QueueUnit{JobId: jobId, Selector: pages[i]})
+		if err != nil {
+			return err
+		}
+		if added {
+			queued++
+		}
+	}
+
+	// nothing left to scrap, or the units are still in the queue
+	if data.QueuedUnits(jobId) == 0 {
+		data.FinishJob(jobId)
+	}
+
+	log.Printf("INFO: Scrap [%s] resumed with %d pages queued\n", jobId, queued)
+	return nil
+}
+
+// Scrap and store through the queue, the items are stored by the workers
+type QueueScrapAndStore struct {
+}
+
+func NewQueueScrapAndStore() ScrapAndStoreItems {
+	return QueueScrapAndStore{}
+}
+
+func (q QueueScrapAndStore) ScrapAndStore(selector ScrapSelector) (string, error) {
+	rdata := NewRedisScrapdata()
+	rdata.SaveSelector(selector)
+
+	return EnqueueJob(selector)
+}
+
+func (q QueueScrapAndStore) ResumeAndStore(jobId string) error {
+	return EnqueueResumedJob(jobId)
+}
+
+func (q QueueScrapAndStore) ScrapPagesAndStore(jobId string, selector ScrapSelector, pages []ScrapSelector) error {
+	return EnqueuePages(jobId, selector, pages)
+}
@@ -0,0 +1,110 @@
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+const (
+	FetchErrorRedirect = "redirect"
+	FetchErrorGone     = "gone"
+)
+
+var (
+	defaultRedirectPolicy RedirectPolicy
+)
+
+func init() {
+	UseRedirectPolicy(RedirectPolicy{
+		MaxHops: 10,
+	})
+}
+
+// Which redirects are followed when fetching a page
+type RedirectPolicy struct {
+	// redirects followed before failing the page
+	MaxHops int `json:"maxHops,omitempty"`
+	// fail the redirects to other host, http to https in the same host is followed
+	SameHost bool `json:"sameHost,omitempty"`
+	// a redirect to other path means the page is gone, like a discontinued product
+	// sent to the category page
+	PathChangeGone bool `json:"pathChangeGone,omitempty"`
+	// index the items by the final url instead of the scraped one
+	IndexFinalUrl bool `json:"indexFinalUrl,omitempty"`
+}
+
+// default redirect policy for all the selectors
+func UseRedirectPolicy(p RedirectPolicy) {
+	defaultRedirectPolicy = p
+}
+
+func redirectPolicyFor(selector ScrapSelector) RedirectPolicy {
+	if selector.Redirect == nil {
+		return defaultRedirectPolicy
+	}
+
+	p := *selector.Redirect
+	if p.MaxHops <= 0 {
+		p.MaxHops = defaultRedirectPolicy.MaxHops
+	}
+	return p
+}
+
+// checks every redirect against the policy, via are the requests already done
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	first := via[0].URL
+	if len(via) > p.MaxHops {
+		return FetchError{
+			Kind: FetchErrorRedirect,
+			Url:  first.String(),
+			Msg:  fmt.Sprintf("more than %v redirects", p.MaxHops),
+		}
+	}
+	if p.SameHost && !strings.EqualFold(first.Host, req.URL.Host) {
+		return FetchError{
+			Kind: FetchErrorRedirect,
+			Url:  first.String(),
+			Msg:  "redirect to other host " + req.URL.Host,
+		}
+	}
+	if p.PathChangeGone && strings.TrimSuffix(first.Path, "/") != strings.TrimSuffix(req.URL.Path, "/") {
+		return FetchError{
+			Kind: FetchErrorGone,
+			Url:  first.String(),
+			Msg:  "redirect to " + req.URL.String(),
+		}
+	}
+	return nil
+}
+
+// copy of the client following the redirect policy of the selector
+func redirectClient(selector ScrapSelector, client *http.Client) *http.Client {
+	dup := *client
+	dup.CheckRedirect = redirectPolicyFor(selector).checkRedirect
+	return &dup
+}
+
+// the client wraps the error of the redirect policy
+func unwrapRedirectError(err error) error {
+	ue, ok := err.(*neturl.Error)
+	if !ok {
+		return err
+	}
+	if fe, ok := ue.Err.(FetchError); ok {
+		return fe
+	}
+	return err
+}
+
+// urls requested before the final one, empty without redirects
+func redirectChain(res *http.Response) []string {
+	var chain []string
+	req := res.Request
+	for req != nil && req.Response != nil {
+		req = req.Response.Request
+		chain = append([]string{req.URL.String()}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dahernan/gopherscraper/model"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const redirectedPage = `<html><body>
+	<div class="product-info"><h2><a href="/p/123">Test</a></h2><span class="id">123</span></div>
+</body></html>`
+
+func TestRedirectPolicy(t *testing.T) {
+	Convey("Redirects follow the policy and are recorded in the items", t, func() {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(redirectedPage))
+		}))
+		defer other.Close()
+
+		hits := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			http.Redirect(w, r, "/shop/new", http.StatusMovedPermanently)
+		})
+		mux.HandleFunc("/shop/new", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(redirectedPage))
+		})
+		mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		})
+		mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, other.URL+"/away", http.StatusFound)
+		})
+		ts := httptest.NewServer(mux)
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:  ts.URL + "/old",
+			Base: ".product-info",
+			Id:   Selector{Exp: ".id"},
+			Link: Selector{Exp: "a", Attr: "href"},
+		}
+
+		Convey("the final url and the chain are in the items", func() {
+			_, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			var results []ItemResult
+			for it := range items {
+				results = append(results, it)
+			}
+			So(len(results), ShouldEqual, 1)
+			item := results[0].Item
+			So(item.ScrapUrl, ShouldEqual, ts.URL+"/old")
+			So(item.FinalUrl, ShouldEqual, ts.URL+"/shop/new")
+			So(item.Redirects, ShouldResemble, []string{ts.URL + "/old"})
+			So(item.Link, ShouldEqual, ts.URL+"/p/123")
+		})
+
+		Convey("a redirect to other path is gone and not retried", func() {
+			s.Redirect = &RedirectPolicy{PathChangeGone: true}
+			_, err := fromUrlWithRetry(context.Background(), "", s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorGone)
+			So(hits, ShouldEqual, 1)
+		})
+
+		Convey("too many redirects fail the page", func() {
+			s.Url = ts.URL + "/loop"
+			s.Redirect = &RedirectPolicy{MaxHops: 3}
+			_, err := fromUrlWithRetry(context.Background(), "", s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorRedirect)
+		})
+
+		Convey("the redirects to other host fail with sameHost", func() {
+			s.Url = ts.URL + "/away"
+			_, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			for it := range items {
+				// the links are from the final host
+				So(it.Item.Link, ShouldEqual, other.URL+"/p/123")
+			}
+
+			s.Redirect = &RedirectPolicy{SameHost: true}
+			_, err = fromUrlWithRetry(context.Background(), "", s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorRedirect)
+		})
+	})
+
+	Convey("The items can be indexed by the final url", t, func() {
+		it := ItemResult{Item: model.Item{
+			Id:       "123",
+			ScrapUrl: "http://track.example.com/r?to=shop",
+			FinalUrl: "https://shop.example.com/p/123",
+		}}
+		So(itemIndex(it), ShouldEqual, "track.example.com/123")
+
+		it.IndexFinalUrl = true
+		So(itemIndex(it), ShouldEqual, "shop.example.com/123")
+	})
+}
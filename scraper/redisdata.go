@@ -3,7 +3,10 @@ package scraper
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,11 +19,43 @@ const (
 	scrapSelectorKeyPrefix = "scrapSelector"
 	scrapJobsKeyPrefix     = "scrapJobs"
 	scrapLogKeyPrefix      = "scrapLog"
+	scrapSessionKeyPrefix  = "scrapSession"
+	scrapRobotsKeyPrefix   = "scrapRobots"
+	scrapAuditKeyPrefix    = "scrapAudit"
+	scrapPolitenessKey     = "scrapPoliteness"
+	scrapHostKeyPrefix     = "scrapHost"
+	scrapCoolDownKey       = "scrapCoolDown"
+	scrapBlockKeyPrefix    = "scrapBlock"
+	scrapProxyKeyPrefix    = "scrapProxy"
+	scrapProfileKey        = "scrapProfile"
+	scrapCacheKeyPrefix    = "scrapCache"
+	scrapUrlRulesKey       = "scrapUrlRules"
+	scrapRunsKeyPrefix     = "scrapRuns"
+	scrapJobsIndexKey      = "scrapJobs:index"
+	scrapJobsErrorsKey     = "scrapJobs:index:errors"
+	scrapQueueReadyKey     = "scrapQueue:ready"
+	scrapQueueWorkingKey   = "scrapQueue:processing"
+	scrapQueueLeasesKey    = "scrapQueue:leases"
+	scrapQueueUnitsKey     = "scrapQueue:units"
+	scrapSchedulesKey      = "scrapSchedules"
+	scrapLeaderKeyPrefix   = "scrapLeader"
+	scrapFreshnessKey      = "scrapFreshness"
+	scrapViewsKeyPrefix    = "scrapViews"
+	scrapChangesKeyPrefix  = "scrapChanges"
+	scrapDueKeyPrefix      = "scrapDue"
+
+	// runs kept for every url
+	maxJobRuns = 50
+
+	fetchErrorDefault = "fetch"
 )
 
 var (
 	ErrSelectorNotFound = errors.New("Selector not found")
 	ErrJobNotFound      = errors.New("Scrap job not found")
+	ErrJobNotRunning    = errors.New("Scrap job is not running")
+	ErrJobNotPaused     = errors.New("Scrap job is not paused")
+	ErrUnitNotFound     = errors.New("Queue unit not found")
 )
 
 type RedisScrapdata struct {
@@ -86,41 +121,501 @@ func (r *RedisScrapdata) Selector(scrapUrl, stype string) (ScrapSelector, error)
 	return s, err
 }
 
+func (r *RedisScrapdata) SaveSession(s SessionSpec) error {
+	err := validateSession(s)
+	if err != nil {
+		return err
+	}
+
+	o, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapSessionKeyPrefix, s.Host, string(o))
+	if err != nil {
+		return err
+	}
+
+	// the old cookies belong to the old credentials
+	_, err = r.client.Del(scrapSessionCookiesKey(s.Host))
+	return err
+}
+
+func (r *RedisScrapdata) Session(host string) (SessionSpec, error) {
+	var s SessionSpec
+
+	data, err := r.client.HGet(scrapSessionKeyPrefix, host)
+	if err != nil {
+		return s, err
+	}
+	if len(data) <= 0 {
+		return s, ErrSessionNotFound
+	}
+
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+func (r *RedisScrapdata) DeleteSession(host string) error {
+	_, err := r.client.HDel(scrapSessionKeyPrefix, host)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Del(scrapSessionCookiesKey(host))
+	return err
+}
+
+func (r *RedisScrapdata) SessionCookies(host string) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+
+	data, err := r.client.HGet(scrapSessionCookiesKey(host), "cookies")
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= 0 {
+		return cookies, nil
+	}
+
+	err = json.Unmarshal(data, &cookies)
+	return cookies, err
+}
+
+func (r *RedisScrapdata) SaveSessionCookies(host string, cookies []*http.Cookie, ttl int) error {
+	key := scrapSessionCookiesKey(host)
+
+	o, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+
+	defer r.client.Expire(key, ttl)
+
+	_, err = r.client.HSet(key, "cookies", string(o))
+	return err
+}
+
 func (r *RedisScrapdata) StartJob(jobId string, s ScrapSelector) error {
 	jobKey := scrapJobsKey(jobId)
 	jobKeyMeta := scrapJobsKeyMeta(jobId)
 
 	defer r.client.Expire(jobKey, 60*10)
-	defer r.client.Expire(jobKeyMeta, 60*60*24)
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+
+	now := time.Now()
+	host := ""
+	if u, err := url.Parse(s.Url); err == nil {
+		host = u.Host
+	}
+
+	r.client.HMSet(jobKeyMeta, map[string]string{
+		"start":    strconv.FormatInt(now.Unix(), 10),
+		"url":      s.Url,
+		"host":     host,
+		"status":   JobStatusRunning,
+		"selector": selectorFingerprint(s),
+	})
 
-	unixTime := time.Now().Unix()
+	// indexes to list the jobs by start time, without the expired ones
+	r.client.ZAdd(scrapJobsIndexKey, map[string]float64{jobId: float64(now.Unix())})
+	r.indexJob(scrapJobsHostKey(host), jobId)
+	r.indexJob(scrapJobsStatusKey(JobStatusRunning), jobId)
 
-	r.client.HIncrBy(jobKeyMeta, "totalHits", 1)
-	r.client.HSet(jobKeyMeta, "start", strconv.FormatInt(unixTime, 10))
-	r.client.HSet(jobKeyMeta, "url", s.Url)
+	indexes := []string{scrapJobsIndexKey, scrapJobsHostKey(host), scrapJobsErrorsKey}
+	for _, status := range jobStatuses {
+		indexes = append(indexes, scrapJobsStatusKey(status))
+	}
+	for _, index := range indexes {
+		expired, _ := r.client.ZRangeByScore(index, "-inf", strconv.FormatInt(now.Unix()-int64(jobRetention), 10), false, false, 0, 0)
+		if len(expired) > 0 {
+			r.client.ZRem(index, expired...)
+		}
+	}
 
-	r.client.HDel(jobKeyMeta, "hits:")
-	r.client.HDel(jobKeyMeta, "items")
-	r.client.HDel(jobKeyMeta, "finish")
-	r.client.HDel(jobKeyMeta, "errors")
-	r.client.HDel(jobKeyMeta, "lastError")
+	// every run has its own job, the url keeps the recent ones
+	runsKey := scrapRunsKey(s.Url)
+	r.client.LPush(runsKey, jobId)
+	r.client.LTrim(runsKey, 0, maxJobRuns-1)
+	r.client.Expire(runsKey, jobRetention)
+
+	if s.IgnoreRobots {
+		r.client.HSet(jobKeyMeta, "ignoreRobots", "true")
+		r.Audit(fmt.Sprintf("%s job %s ignores robots.txt for %s", time.Now().Format(time.RFC3339), jobId, s.Url))
+	}
 
 	return nil
 }
 
+// summaries of the jobs matching the filter, the newest first. The jobs are filtered
+// and paginated with the indexes, only the summaries of the page are loaded
+func (r *RedisScrapdata) Jobs(filter JobFilter) (JobList, error) {
+	list := JobList{Jobs: []JobSummary{}}
+
+	now := time.Now()
+	min, max := now.Unix()-int64(jobRetention), "+inf"
+	if !filter.StartedAfter.IsZero() && filter.StartedAfter.Unix() > min {
+		min = filter.StartedAfter.Unix()
+	}
+	if !filter.StartedBefore.IsZero() {
+		max = strconv.FormatInt(filter.StartedBefore.Unix(), 10)
+	}
+	jobsIn := func(index string) ([]string, error) {
+		return r.client.ZRangeByScore(index, strconv.FormatInt(min, 10), max, false, false, 0, 0)
+	}
+
+	index := scrapJobsIndexKey
+	var within []string
+	if filter.Host != "" {
+		index = scrapJobsHostKey(filter.Host)
+	}
+	if filter.Status != "" {
+		if filter.Host != "" {
+			within = append(within, index)
+		}
+		index = scrapJobsStatusKey(filter.Status)
+	}
+	if filter.HasErrors != nil && *filter.HasErrors {
+		within = append(within, scrapJobsErrorsKey)
+	}
+
+	jobIds, err := jobsIn(index)
+	if err != nil {
+		return list, err
+	}
+	for _, key := range within {
+		ids, err := jobsIn(key)
+		if err != nil {
+			return list, err
+		}
+		jobIds = intersectJobs(jobIds, ids, true)
+	}
+	if filter.HasErrors != nil && !*filter.HasErrors {
+		ids, err := jobsIn(scrapJobsErrorsKey)
+		if err != nil {
+			return list, err
+		}
+		jobIds = intersectJobs(jobIds, ids, false)
+	}
+
+	list.Total = len(jobIds)
+	for i := len(jobIds) - 1 - filter.Offset; i >= 0 && len(list.Jobs) < filter.limit(); i-- {
+		meta, err := r.client.HGetAll(scrapJobsKeyMeta(jobIds[i]))
+		if err != nil {
+			return list, err
+		}
+		if len(meta) == 0 {
+			r.client.ZRem(scrapJobsIndexKey, jobIds[i])
+			list.Total--
+			continue
+		}
+		list.Jobs = append(list.Jobs, jobSummary(jobIds[i], meta, now))
+	}
+	return list, nil
+}
+
+// the jobs in the other index, or the ones not in it, in the same order
+func intersectJobs(jobIds []string, other []string, in bool) []string {
+	set := make(map[string]bool, len(other))
+	for _, id := range other {
+		set[id] = true
+	}
+	result := []string{}
+	for _, id := range jobIds {
+		if set[id] == in {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// adds the job to an index of the listing, scored by its start
+func (r *RedisScrapdata) indexJob(index string, jobId string) {
+	start, err := r.client.ZScore(scrapJobsIndexKey, jobId)
+	if err != nil || len(start) == 0 {
+		return
+	}
+	score, err := strconv.ParseFloat(string(start), 64)
+	if err != nil {
+		return
+	}
+	r.client.ZAdd(index, map[string]float64{jobId: score})
+	r.client.Expire(index, jobRetention)
+}
+
+// the status of the job, it is moved to the index of the status
+func (r *RedisScrapdata) setJobStatus(jobId string, status string) {
+	r.client.HSet(scrapJobsKeyMeta(jobId), "status", status)
+	for _, s := range jobStatuses {
+		if s != status {
+			r.client.ZRem(scrapJobsStatusKey(s), jobId)
+		}
+	}
+	r.indexJob(scrapJobsStatusKey(status), jobId)
+}
+
+// ids of the recent jobs of the url, the newest first
+func (r *RedisScrapdata) JobRuns(scrapUrl string) ([]string, error) {
+	return r.client.LRange(scrapRunsKey(scrapUrl), 0, -1)
+}
+
+// records an attempt to fetch the page of the selector, the page keeps the kind of error
+// of every failed attempt
+func (r *RedisScrapdata) JobAttempt(jobId string, s ScrapSelector, attempt int, err error) {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+	jobKeyPages := scrapJobsKeyPages(jobId)
+
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+	defer r.client.Expire(jobKeyPages, jobRetention)
+
+	r.client.HIncrBy(jobKeyMeta, "attempts", 1)
+	if attempt > 1 {
+		r.client.HIncrBy(jobKeyMeta, "retries", 1)
+	}
+
+	key := requestKey(s)
+	page := r.jobPage(jobId, key)
+	page.Url = s.Url
+	page.Attempts = attempt
+	page.Status = "fetching"
+	if err != nil {
+		page.AttemptErrors = append(page.AttemptErrors, errorKind(err))
+	}
+
+	o, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+	r.client.HSet(jobKeyPages, key, string(o))
+}
+
+type JobPageResult struct {
+	Url      string `json:"url"`
+	Attempts int    `json:"attempts"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Charset  string `json:"charset,omitempty"`
+	// kind of the error of every failed attempt
+	AttemptErrors []string `json:"attemptErrors,omitempty"`
+}
+
+// the page recorded in the job with the key of its request, empty when it is not recorded yet
+func (r *RedisScrapdata) jobPage(jobId string, key string) JobPageResult {
+	var page JobPageResult
+	o, err := r.client.HGet(scrapJobsKeyPages(jobId), key)
+	if err == nil && len(o) > 0 {
+		json.Unmarshal(o, &page)
+	}
+	return page
+}
+
+// records the final result of the page of the selector after all the attempts
+func (r *RedisScrapdata) JobPage(jobId string, s ScrapSelector, attempts int, charset string, err error) {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+	jobKeyPages := scrapJobsKeyPages(jobId)
+
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+	defer r.client.Expire(jobKeyPages, jobRetention)
+
+	key := requestKey(s)
+	page := r.jobPage(jobId, key)
+	page.Url = s.Url
+	page.Attempts = attempts
+	page.Status = "ok"
+	page.Error = ""
+	page.Charset = charset
+	if err != nil {
+		page.Status = "failed"
+		page.Error = redactCredentials(err.Error())
+	}
+	r.client.HIncrBy(jobKeyMeta, "pages:"+page.Status, 1)
+	if charset != "" {
+		r.client.HIncrBy(jobKeyMeta, "charset:"+charset, 1)
+	}
+	if err == nil && attempts > 1 {
+		r.client.HIncrBy(jobKeyMeta, "pages:retried", 1)
+	}
+
+	o, err := json.Marshal(page)
+	if err != nil {
+		return
+	}
+	r.client.HSet(jobKeyPages, key, string(o))
+}
+
+// counts the cache hits and misses of the job
+func (r *RedisScrapdata) JobCache(jobId string, status string) {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+
+	r.client.HIncrBy(jobKeyMeta, "cache:"+status, 1)
+}
+
+// the kind of the error fetching a page
+func errorKind(err error) string {
+	if fe, ok := err.(FetchError); ok {
+		return fe.Kind
+	}
+	return fetchErrorDefault
+}
+
+// records an error fetching a page, counted by kind
+func (r *RedisScrapdata) JobError(jobId string, err error) {
+	jobKey := scrapJobsKey(jobId)
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+
+	defer r.client.Expire(jobKey, 60*10)
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+
+	kind := errorKind(err)
+	status := 0
+	if fe, ok := err.(FetchError); ok {
+		status = fe.StatusCode
+	}
+
+	r.client.HIncrBy(jobKeyMeta, "errors", 1)
+	r.client.HIncrBy(jobKeyMeta, "errors:"+kind, 1)
+	r.indexJob(scrapJobsErrorsKey, jobId)
+	if status != 0 {
+		r.client.HIncrBy(jobKeyMeta, "errors:status:"+strconv.Itoa(status), 1)
+	}
+	r.client.HSet(jobKeyMeta, "lastError", redactCredentials(err.Error()))
+}
+
 func (r *RedisScrapdata) FinishJob(jobId string) error {
 	jobKey := scrapJobsKey(jobId)
 	jobKeyMeta := scrapJobsKeyMeta(jobId)
 
 	defer r.client.Expire(jobKey, 60*10)
-	defer r.client.Expire(jobKeyMeta, 60*60*24)
+	defer r.client.Expire(jobKeyMeta, jobRetention)
+
+	status, _ := r.client.HGet(jobKeyMeta, "status")
+	// a paused job finishes when it is resumed
+	if string(status) == JobStatusPaused {
+		return nil
+	}
 
 	unixTime := strconv.FormatInt(time.Now().Unix(), 10)
 	r.client.HSet(jobKeyMeta, "finish", unixTime)
 
+	if string(status) != JobStatusCancelled {
+		r.setJobStatus(jobId, JobStatusFinished)
+	}
+	r.client.Del(scrapJobsKeyPending(jobId))
+
+	return nil
+}
+
+func (r *RedisScrapdata) JobStatus(jobId string) (string, error) {
+	status, err := r.client.HGet(scrapJobsKeyMeta(jobId), "status")
+	if err != nil {
+		return "", err
+	}
+	if len(status) == 0 {
+		return "", ErrJobNotFound
+	}
+	return string(status), nil
+}
+
+// marks the running or paused job as cancelled, it keeps the counts until it stops
+func (r *RedisScrapdata) CancelJob(jobId string) error {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+
+	status, err := r.JobStatus(jobId)
+	if err != nil {
+		return err
+	}
+	if status != JobStatusRunning && status != JobStatusPaused {
+		return ErrJobNotRunning
+	}
+
+	r.setJobStatus(jobId, JobStatusCancelled)
+	r.client.HSet(jobKeyMeta, "cancelled", strconv.FormatInt(time.Now().Unix(), 10))
+
+	// nothing is running a paused job
+	if status == JobStatusPaused {
+		r.FinishJob(jobId)
+	}
+	return nil
+}
+
+// marks the running job as paused, its pending pages are kept
+func (r *RedisScrapdata) PauseJob(jobId string) error {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+
+	status, err := r.JobStatus(jobId)
+	if err != nil {
+		return err
+	}
+	if status != JobStatusRunning {
+		return ErrJobNotRunning
+	}
+
+	r.setJobStatus(jobId, JobStatusPaused)
+	r.client.HSet(jobKeyMeta, "paused", strconv.FormatInt(time.Now().Unix(), 10))
+	return nil
+}
+
+// marks the paused job as running again, the job and its pending pages
+// are kept for the retention again
+func (r *RedisScrapdata) ResumeJob(jobId string) error {
+	jobKeyMeta := scrapJobsKeyMeta(jobId)
+
+	status, err := r.JobStatus(jobId)
+	if err != nil {
+		return err
+	}
+	if status != JobStatusPaused {
+		return ErrJobNotPaused
+	}
+
+	r.setJobStatus(jobId, JobStatusRunning)
+	r.client.HIncrBy(jobKeyMeta, "resumed", 1)
+	r.client.Expire(jobKeyMeta, jobRetention)
+	r.client.Expire(scrapJobsKeyPending(jobId), jobRetention)
 	return nil
 }
 
+// the page is pending in the job until it is scraped
+func (r *RedisScrapdata) AddPendingPage(jobId string, s ScrapSelector) {
+	if jobId == "" {
+		return
+	}
+	pendingKey := scrapJobsKeyPending(jobId)
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return
+	}
+	r.client.HSet(pendingKey, selectorFingerprint(s), string(b))
+	r.client.Expire(pendingKey, jobRetention)
+}
+
+func (r *RedisScrapdata) DonePendingPage(jobId string, s ScrapSelector) {
+	if jobId == "" {
+		return
+	}
+	r.client.HDel(scrapJobsKeyPending(jobId), selectorFingerprint(s))
+}
+
+// the pages and the recursive links not scraped yet by the job
+func (r *RedisScrapdata) PendingPages(jobId string) ([]ScrapSelector, error) {
+	pendingMap, err := r.client.HGetAll(scrapJobsKeyPending(jobId))
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []ScrapSelector{}
+	for k, _ := range pendingMap {
+		var s ScrapSelector
+		err := json.Unmarshal([]byte(pendingMap[k]), &s)
+		if err != nil {
+			continue
+		}
+		pages = append(pages, s)
+	}
+	return pages, nil
+}
+
 func (r *RedisScrapdata) ScrapJob(jobId string) (map[string]interface{}, error) {
 	result := map[string]interface{}{}
 
@@ -149,37 +644,890 @@ func (r *RedisScrapdata) ScrapJob(jobId string) (map[string]interface{}, error)
 		return result, ErrJobNotFound
 	}
 
+	pagesMap, err := r.client.HGetAll(scrapJobsKeyPages(jobId))
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []JobPageResult
+	for k, _ := range pagesMap {
+		var p JobPageResult
+		json.Unmarshal([]byte(pagesMap[k]), &p)
+		pages = append(pages, p)
+	}
+
+	pending, err := r.client.HKeys(scrapJobsKeyPending(jobId))
+	if err != nil {
+		return nil, err
+	}
+
 	result["meta"] = meta
 	result["items"] = items
+	result["pages"] = pages
+	result["pending"] = len(pending)
 
 	return result, nil
 }
 
-func (r *RedisScrapdata) ScrapLog() []string {
-	logKey := scrapLogKey()
-	r.ScrapLogTrim()
-	log, _ := r.client.LRange(logKey, 0, -1)
-	return log
+// queues the unit unless it is already queued, the job counts its queued units
+func (r *RedisScrapdata) EnqueueUnit(u QueueUnit) (bool, error) {
+	u.Selector = pendingPage(u.Selector)
+	u.Id = u.JobId + ":" + selectorFingerprint(u.Selector)
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		return false, err
+	}
+	added, err := r.client.HSetnx(scrapQueueUnitsKey, u.Id, string(b))
+	if err != nil || !added {
+		return false, err
+	}
+
+	r.AddPendingPage(u.JobId, u.Selector)
+	r.client.HIncrBy(scrapJobsKeyMeta(u.JobId), "queued", 1)
+	_, err = r.client.LPush(scrapQueueReadyKey, u.Id)
+	return true, err
 }
 
-func (r *RedisScrapdata) ScrapLogWrite(line string) {
-	logKey := scrapLogKey()
-	r.client.LPush(logKey, line)
+// takes the oldest unit of the queue, the unit is leased until it is acked or
+// the lease expires without heartbeats
+func (r *RedisScrapdata) LeaseUnit(lease time.Duration) (QueueUnit, bool, error) {
+	var u QueueUnit
+
+	id, err := r.client.RPopLPush(scrapQueueReadyKey, scrapQueueWorkingKey)
+	if err != nil || len(id) == 0 {
+		return u, false, err
+	}
+	r.HeartbeatUnit(string(id), lease)
+
+	data, err := r.client.HGet(scrapQueueUnitsKey, string(id))
+	if err != nil {
+		return u, false, err
+	}
+	// acked by another worker after its lease expired
+	if len(data) == 0 {
+		r.client.LRem(scrapQueueWorkingKey, 0, string(id))
+		r.client.ZRem(scrapQueueLeasesKey, string(id))
+		return u, false, nil
+	}
+
+	err = json.Unmarshal(data, &u)
+	return u, err == nil, err
 }
 
-func (r *RedisScrapdata) ScrapLogTrim() {
-	logKey := scrapLogKey()
-	r.client.LTrim(logKey, 0, 40)
+func (r *RedisScrapdata) HeartbeatUnit(id string, lease time.Duration) {
+	r.client.ZAdd(scrapQueueLeasesKey, map[string]float64{id: float64(time.Now().Add(lease).Unix())})
 }
 
-func scrapLogKey() string {
-	return scrapLogKeyPrefix
+// the unit is done, the page is not pending anymore if it was scraped.
+// The last unit of the job finishes it
+func (r *RedisScrapdata) AckUnit(u QueueUnit, scraped bool) {
+	r.client.LRem(scrapQueueWorkingKey, 0, u.Id)
+	r.client.ZRem(scrapQueueLeasesKey, u.Id)
+	deleted, _ := r.client.HDel(scrapQueueUnitsKey, u.Id)
+	// acked already by another worker
+	if deleted == 0 {
+		return
+	}
+
+	if scraped {
+		r.DonePendingPage(u.JobId, u.Selector)
+	}
+	queued, _ := r.client.HIncrBy(scrapJobsKeyMeta(u.JobId), "queued", -1)
+	if queued <= 0 {
+		r.FinishJob(u.JobId)
+	}
 }
 
-func scrapJobsKey(jobId string) string {
-	return scrapJobsKeyPrefix + ":" + jobId
+// queues the unit again, at the end of the queue
+func (r *RedisScrapdata) RetryUnit(u QueueUnit) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	r.client.HSet(scrapQueueUnitsKey, u.Id, string(b))
+	r.client.LRem(scrapQueueWorkingKey, 0, u.Id)
+	r.client.ZRem(scrapQueueLeasesKey, u.Id)
+	_, err = r.client.LPush(scrapQueueReadyKey, u.Id)
+	return err
 }
 
-func scrapJobsKeyMeta(jobId string) string {
-	return scrapJobsKey(jobId) + ":meta"
+// the units being processed, with the unix time their lease expires,
+// 0 if the unit has not been leased yet
+func (r *RedisScrapdata) LeasedUnits() (map[string]int64, error) {
+	ids, err := r.client.LRange(scrapQueueWorkingKey, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := map[string]int64{}
+	for _, id := range ids {
+		score, _ := r.client.ZScore(scrapQueueLeasesKey, id)
+		expires, _ := strconv.ParseFloat(string(score), 64)
+		leases[id] = int64(expires)
+	}
+	return leases, nil
+}
+
+func (r *RedisScrapdata) QueuedUnit(id string) (QueueUnit, error) {
+	var u QueueUnit
+	data, err := r.client.HGet(scrapQueueUnitsKey, id)
+	if err != nil {
+		return u, err
+	}
+	if len(data) == 0 {
+		return u, ErrUnitNotFound
+	}
+	err = json.Unmarshal(data, &u)
+	return u, err
+}
+
+// units of the job in the queue or being processed
+func (r *RedisScrapdata) QueuedUnits(jobId string) int64 {
+	queued, _ := r.client.HGet(scrapJobsKeyMeta(jobId), "queued")
+	n, _ := strconv.ParseInt(string(queued), 10, 64)
+	return n
+}
+
+func (r *RedisScrapdata) QueueLength() int64 {
+	length, _ := r.client.LLen(scrapQueueReadyKey)
+	return length
+}
+
+// saves the schedule with its next run, a new schedule gets an id
+func (r *RedisScrapdata) SaveSchedule(s Schedule) (Schedule, error) {
+	err := validateSchedule(s)
+	if err != nil {
+		return s, err
+	}
+
+	if s.Id == "" {
+		s.Id = NewJobId("S")
+	}
+	s.NextRun = s.nextRun(time.Now())
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return s, err
+	}
+	run, err := json.Marshal(s.run())
+	if err != nil {
+		return s, err
+	}
+	err = r.client.HMSet(scrapSchedulesKey, map[string]string{
+		s.Id:                      string(b),
+		scrapScheduleRunKey(s.Id): string(run),
+	})
+	return s, err
+}
+
+// records a run of the schedule, only the last and next run fields. The schedule
+// is not saved again, so it is not brought back when it was deleted meanwhile
+func (r *RedisScrapdata) SaveScheduleRun(s Schedule) error {
+	found, err := r.client.HExists(scrapSchedulesKey, s.Id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrScheduleNotFound
+	}
+
+	run, err := json.Marshal(s.run())
+	if err != nil {
+		return err
+	}
+	_, err = r.client.HSet(scrapSchedulesKey, scrapScheduleRunKey(s.Id), string(run))
+
+	// deleted while the run was recorded
+	if found, _ := r.client.HExists(scrapSchedulesKey, s.Id); !found {
+		r.client.HDel(scrapSchedulesKey, scrapScheduleRunKey(s.Id))
+	}
+	return err
+}
+
+func (r *RedisScrapdata) Schedule(id string) (Schedule, error) {
+	var s Schedule
+	data, err := r.client.HGet(scrapSchedulesKey, id)
+	if err != nil {
+		return s, err
+	}
+	if len(data) == 0 {
+		return s, ErrScheduleNotFound
+	}
+	err = json.Unmarshal(data, &s)
+	if err != nil {
+		return s, err
+	}
+
+	var run scheduleRun
+	data, err = r.client.HGet(scrapSchedulesKey, scrapScheduleRunKey(id))
+	if err == nil && json.Unmarshal(data, &run) == nil {
+		s.setRun(run)
+	}
+	return s, nil
+}
+
+// the schedules sorted by the next run
+func (r *RedisScrapdata) Schedules() ([]Schedule, error) {
+	schedulesMap, err := r.client.HGetAll(scrapSchedulesKey)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules := []Schedule{}
+	for k, _ := range schedulesMap {
+		if strings.HasSuffix(k, scheduleRunSuffix) {
+			continue
+		}
+		var s Schedule
+		err := json.Unmarshal([]byte(schedulesMap[k]), &s)
+		if err != nil {
+			continue
+		}
+		var run scheduleRun
+		if json.Unmarshal([]byte(schedulesMap[scrapScheduleRunKey(k)]), &run) == nil {
+			s.setRun(run)
+		}
+		schedules = append(schedules, s)
+	}
+	sort.Sort(byNextRun(schedules))
+	return schedules, nil
+}
+
+func (r *RedisScrapdata) DeleteSchedule(id string) error {
+	deleted, err := r.client.HDel(scrapSchedulesKey, id)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrScheduleNotFound
+	}
+	r.client.HDel(scrapSchedulesKey, scrapScheduleRunKey(id))
+	return nil
+}
+
+// takes or renews the lock for ttl seconds, true if the instance holds it
+func (r *RedisScrapdata) LeaderLock(name string, instance string, ttl int) bool {
+	key := scrapLeaderKeyPrefix + ":" + name
+
+	taken, _ := r.client.SetNxPx(key, instance, ttl*1000)
+	if taken {
+		return true
+	}
+
+	owner, _ := r.client.Get(key)
+	if string(owner) == instance {
+		r.client.Expire(key, ttl)
+		return true
+	}
+	return false
+}
+
+func (r *RedisScrapdata) SaveHostFreshness(f Freshness) error {
+	err := validateFreshness(f)
+	if err != nil {
+		return err
+	}
+
+	o, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapFreshnessKey, f.Host, string(o))
+	return err
+}
+
+func (r *RedisScrapdata) HostFreshness(host string) (Freshness, error) {
+	f := Freshness{Host: host}
+
+	data, err := r.client.HGet(scrapFreshnessKey, host)
+	if err != nil {
+		return f, err
+	}
+	if len(data) <= 0 {
+		return f, nil
+	}
+
+	err = json.Unmarshal(data, &f)
+	return f, err
+}
+
+func (r *RedisScrapdata) DeleteHostFreshness(host string) error {
+	_, err := r.client.HDel(scrapFreshnessKey, host)
+	return err
+}
+
+// the hosts with a detail selector saved
+func (r *RedisScrapdata) DetailSelectorHosts() ([]string, error) {
+	keys, err := r.client.HKeys(scrapSelectorKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+	for _, k := range keys {
+		if strings.HasSuffix(k, ":"+SelectorTypeDetail) {
+			hosts = append(hosts, strings.TrimSuffix(k, ":"+SelectorTypeDetail))
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// the item was read through the API, the popular items are refreshed first
+func (r *RedisScrapdata) ItemViewed(host string, id string) {
+	r.client.HIncrBy(scrapViewsKey(host), id, 1)
+}
+
+func (r *RedisScrapdata) ItemViews(host string, id string) int {
+	views, _ := r.client.HGet(scrapViewsKey(host), id)
+	n, _ := strconv.Atoi(string(views))
+	return n
+}
+
+// change rate learned for the item, ErrItemNotObserved until it is scraped
+func (r *RedisScrapdata) ItemChanges(host string, id string) (ItemChanges, error) {
+	var c ItemChanges
+	data, err := r.client.HGet(scrapChangesKey(host), id)
+	if err != nil {
+		return c, err
+	}
+	if len(data) == 0 {
+		return c, ErrItemNotObserved
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func (r *RedisScrapdata) SaveItemChanges(c ItemChanges) error {
+	o, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapChangesKey(c.Host), c.Id, string(o))
+	if err != nil {
+		return err
+	}
+	_, err = r.client.ZAdd(scrapDueKey(c.Host), map[string]float64{c.Id: float64(c.NextDue.Unix())})
+	return err
+}
+
+func (r *RedisScrapdata) RemoveDueItem(host string, id string) error {
+	_, err := r.client.ZRem(scrapDueKey(host), id)
+	return err
+}
+
+// the observed items of the host due before the time, the most overdue first
+func (r *RedisScrapdata) DueItems(host string, now time.Time, size int) ([]ItemChanges, error) {
+	ids, err := r.client.ZRangeByScore(scrapDueKey(host), "-inf", strconv.FormatInt(now.Unix(), 10), false, true, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []ItemChanges
+	for _, id := range ids {
+		c, err := r.ItemChanges(host, id)
+		if err != nil {
+			continue
+		}
+		due = append(due, c)
+	}
+	return due, nil
+}
+
+func (r *RedisScrapdata) Robots(host string) (*robotsRules, bool, error) {
+	data, err := r.client.HGetAll(scrapRobotsKey(host))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(data) == 0 {
+		return nil, false, nil
+	}
+
+	status, _ := strconv.Atoi(data["status"])
+	if status >= 500 {
+		return &robotsRules{disallowAll: true}, true, nil
+	}
+	return parseRobots(data["body"]), true, nil
+}
+
+func (r *RedisScrapdata) SaveRobots(host string, status int, body string, ttl int) error {
+	key := scrapRobotsKey(host)
+	defer r.client.Expire(key, ttl)
+
+	_, err := r.client.HSet(key, "status", strconv.Itoa(status))
+	if err != nil {
+		return err
+	}
+	_, err = r.client.HSet(key, "body", body)
+	return err
+}
+
+func (r *RedisScrapdata) SaveHostPoliteness(p Politeness) error {
+	err := validatePoliteness(p)
+	if err != nil {
+		return err
+	}
+
+	o, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapPolitenessKey, p.Host, string(o))
+	return err
+}
+
+// limits configured for the host, empty if there are none
+func (r *RedisScrapdata) HostPoliteness(host string) (Politeness, error) {
+	p := Politeness{Host: host}
+
+	data, err := r.client.HGet(scrapPolitenessKey, host)
+	if err != nil {
+		return p, err
+	}
+	if len(data) <= 0 {
+		return p, nil
+	}
+
+	err = json.Unmarshal(data, &p)
+	return p, err
+}
+
+func (r *RedisScrapdata) DeleteHostPoliteness(host string) error {
+	_, err := r.client.HDel(scrapPolitenessKey, host)
+	return err
+}
+
+// takes a free slot of the host until it is released or the lease expires,
+// -1 when all the slots are taken
+func (r *RedisScrapdata) AcquireHostSlot(host string, slots int, token string, lease time.Duration) (int, error) {
+	for i := 0; i < slots; i++ {
+		taken, err := r.client.SetNxPx(scrapHostSlotKey(host, i), token, int(lease/time.Millisecond))
+		if err != nil {
+			return -1, err
+		}
+		if taken {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+func (r *RedisScrapdata) ReleaseHostSlot(host string, slot int, token string) {
+	r.releaseLease(scrapHostSlotKey(host, slot), token)
+}
+
+// reserves a request to the host for the rate and the burst, and returns how long to wait for it
+func (r *RedisScrapdata) ReserveHostRate(host string, rate float64, burst int) (time.Duration, error) {
+	interval := time.Duration(float64(time.Second) / rate)
+	return r.reserveHit(scrapHostKey(host)+":rate", interval, burst)
+}
+
+// reserves a request to the host after the crawl delay of the last one, and returns how long to wait for it
+func (r *RedisScrapdata) ReserveCrawlDelay(host string, delay time.Duration) (time.Duration, error) {
+	return r.reserveHit(scrapHostKey(host)+":crawlDelay", delay, 1)
+}
+
+// takes the hit and moves the next one in a single script, the key expires when the host is idle
+const reserveHitScript = `
+local now = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local next = tonumber(redis.call('get', KEYS[1])) or now
+if next < now then next = now end
+local wait = next - (burst - 1) * interval - now
+next = next + interval
+redis.call('set', KEYS[1], next, 'PX', next - now + 1000)
+if wait < 0 then wait = 0 end
+return wait
+`
+
+// The key keeps the time of the next hit at the interval, and burst hits
+// can be taken ahead of it. A hit taken ahead of time is paid waiting
+func (r *RedisScrapdata) reserveHit(key string, interval time.Duration, burst int) (time.Duration, error) {
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	wait, err := r.client.EvalInt(reserveHitScript, []string{key}, now, int64(interval/time.Millisecond), burst)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+const releaseLeaseScript = `
+if redis.call('get', KEYS[1]) == ARGV[1] then
+	return redis.call('del', KEYS[1])
+end
+return 0
+`
+
+// deletes the key only if the lease was not expired and taken by other
+func (r *RedisScrapdata) releaseLease(key string, token string) {
+	r.client.EvalInt(releaseLeaseScript, []string{key}, token)
+}
+
+func (r *RedisScrapdata) SaveCoolDown(c CoolDown) error {
+	o, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapCoolDownKey, c.Host, string(o))
+	return err
+}
+
+// the cool-down of the host, the expired ones are removed
+func (r *RedisScrapdata) CoolDown(host string) (CoolDown, error) {
+	var c CoolDown
+
+	data, err := r.client.HGet(scrapCoolDownKey, host)
+	if err != nil {
+		return c, err
+	}
+	if len(data) <= 0 {
+		return c, ErrCoolDownNotFound
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, err
+	}
+
+	if c.Until.Before(time.Now()) {
+		r.client.HDel(scrapCoolDownKey, host)
+		return c, ErrCoolDownNotFound
+	}
+	return c, nil
+}
+
+func (r *RedisScrapdata) CoolDowns() ([]CoolDown, error) {
+	all, err := r.client.HGetAll(scrapCoolDownKey)
+	if err != nil {
+		return nil, err
+	}
+
+	coolDowns := []CoolDown{}
+	for host, _ := range all {
+		c, err := r.CoolDown(host)
+		if err == ErrCoolDownNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		coolDowns = append(coolDowns, c)
+	}
+	return coolDowns, nil
+}
+
+// clears the cool-down and the block signals of the host
+func (r *RedisScrapdata) ClearCoolDown(host string) error {
+	_, err := r.client.HDel(scrapCoolDownKey, host)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.Del(scrapBlockKey(host))
+	return err
+}
+
+// counts one more consecutive block signal of the kind for the host
+func (r *RedisScrapdata) BlockSignal(host string, kind string) int64 {
+	key := scrapBlockKey(host)
+	defer r.client.Expire(key, 60*60*24)
+
+	n, _ := r.client.HIncrBy(key, kind, 1)
+	return n
+}
+
+func (r *RedisScrapdata) ResetBlockSignal(host string, kind string) {
+	r.client.HDel(scrapBlockKey(host), kind)
+}
+
+// the selector had pages of the host with Base matches
+func (r *RedisScrapdata) BlockSignalMatched(host string, s ScrapSelector) {
+	key := scrapBlockKey(host)
+	defer r.client.Expire(key, 60*60*24)
+
+	r.client.HSet(key, "matched:"+extractionFingerprint(s), "true")
+}
+
+func (r *RedisScrapdata) BlockSignalHasMatched(host string, s ScrapSelector) bool {
+	data, _ := r.client.HGet(scrapBlockKey(host), "matched:"+extractionFingerprint(s))
+	return string(data) == "true"
+}
+
+// cached copy of the page with the cache key, the body is stored compressed
+func (r *RedisScrapdata) HttpCache(key string) (CacheEntry, bool, error) {
+	c := CacheEntry{}
+
+	data, err := r.client.HGetAll(scrapCacheKey(key))
+	if err != nil {
+		return c, false, err
+	}
+	if len(data) == 0 {
+		return c, false, nil
+	}
+
+	c.Body, err = gunzipBytes([]byte(data["body"]))
+	if err != nil {
+		// a broken copy is a miss
+		return c, false, nil
+	}
+	c.Url = data["url"]
+	c.ETag = data["etag"]
+	c.LastModified = data["lastModified"]
+	c.ContentType = data["contentType"]
+	c.Selector = data["selector"]
+	c.Fetched, _ = time.Parse(time.RFC3339, data["fetched"])
+	return c, true, nil
+}
+
+func (r *RedisScrapdata) SaveHttpCache(cacheKey string, c CacheEntry, ttl int) error {
+	key := scrapCacheKey(cacheKey)
+	defer r.client.Expire(key, ttl)
+
+	body, err := gzipBytes(c.Body)
+	if err != nil {
+		return err
+	}
+
+	return r.client.HMSet(key, map[string]string{
+		"url":          c.Url,
+		"etag":         c.ETag,
+		"lastModified": c.LastModified,
+		"contentType":  c.ContentType,
+		"selector":     c.Selector,
+		"fetched":      c.Fetched.Format(time.RFC3339),
+		"body":         string(body),
+	})
+}
+
+func (r *RedisScrapdata) SaveHostProfile(hp HostProfile) error {
+	err := validateHostProfile(hp)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapProfileKey, hp.Host, hp.Profile)
+	return err
+}
+
+// name of the profile pinned to the host, empty if there is none
+func (r *RedisScrapdata) HostProfile(host string) (string, error) {
+	data, err := r.client.HGet(scrapProfileKey, host)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (r *RedisScrapdata) DeleteHostProfile(host string) error {
+	_, err := r.client.HDel(scrapProfileKey, host)
+	return err
+}
+
+func (r *RedisScrapdata) SaveHostUrlRules(rules UrlRules) error {
+	err := validateUrlRules(rules)
+	if err != nil {
+		return err
+	}
+	rules.Host = strings.ToLower(rules.Host)
+
+	o, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.HSet(scrapUrlRulesKey, rules.Host, string(o))
+	return err
+}
+
+// url rules configured for the host, empty if there are none
+func (r *RedisScrapdata) HostUrlRules(host string) (UrlRules, error) {
+	rules := UrlRules{Host: host}
+
+	data, err := r.client.HGet(scrapUrlRulesKey, strings.ToLower(host))
+	if err != nil {
+		return rules, err
+	}
+	if len(data) <= 0 {
+		return rules, nil
+	}
+
+	err = json.Unmarshal(data, &rules)
+	return rules, err
+}
+
+func (r *RedisScrapdata) DeleteHostUrlRules(host string) error {
+	_, err := r.client.HDel(scrapUrlRulesKey, strings.ToLower(host))
+	return err
+}
+
+// proxy id assigned to the host in the pool
+func (r *RedisScrapdata) ProxyAssignment(pool string, host string) string {
+	data, _ := r.client.HGet(scrapProxyAssignKey(pool), host)
+	return string(data)
+}
+
+func (r *RedisScrapdata) SaveProxyAssignment(pool string, host string, proxy string) {
+	r.client.HSet(scrapProxyAssignKey(pool), host, proxy)
+}
+
+func (r *RedisScrapdata) DeleteProxyAssignment(pool string, host string) {
+	r.client.HDel(scrapProxyAssignKey(pool), host)
+}
+
+// health of the proxy, a proxy never used is healthy
+func (r *RedisScrapdata) ProxyHealth(proxy string) ProxyHealth {
+	h := ProxyHealth{Proxy: proxy, Score: 1}
+
+	data, err := r.client.HGet(scrapProxyHealthKey(), proxy)
+	if err != nil || len(data) <= 0 {
+		return h
+	}
+	json.Unmarshal(data, &h)
+	return h
+}
+
+// updates the health score of the proxy with the result of a request
+func (r *RedisScrapdata) SaveProxyResult(proxy string, ok bool, lastError string, when time.Time) error {
+	h := r.ProxyHealth(proxy)
+
+	result := 0.0
+	if ok {
+		result = 1.0
+	} else {
+		h.Failures++
+		h.LastError = lastError
+	}
+	h.Requests++
+	h.Score = h.Score*0.8 + result*0.2
+	h.LastUsed = when.Format(time.RFC3339)
+
+	o, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.HSet(scrapProxyHealthKey(), proxy, string(o))
+	return err
+}
+
+// audit trail of the selectors overriding the crawling rules
+func (r *RedisScrapdata) AuditLog() []string {
+	auditKey := scrapAuditKey()
+	log, _ := r.client.LRange(auditKey, 0, -1)
+	return log
+}
+
+func (r *RedisScrapdata) Audit(line string) {
+	auditKey := scrapAuditKey()
+	r.client.LPush(auditKey, line)
+	r.client.LTrim(auditKey, 0, 1000)
+}
+
+func (r *RedisScrapdata) ScrapLog() []string {
+	logKey := scrapLogKey()
+	r.ScrapLogTrim()
+	log, _ := r.client.LRange(logKey, 0, -1)
+	return log
+}
+
+func (r *RedisScrapdata) ScrapLogWrite(line string) {
+	logKey := scrapLogKey()
+	r.client.LPush(logKey, line)
+}
+
+func (r *RedisScrapdata) ScrapLogTrim() {
+	logKey := scrapLogKey()
+	r.client.LTrim(logKey, 0, 40)
+}
+
+func scrapLogKey() string {
+	return scrapLogKeyPrefix
+}
+
+func scrapAuditKey() string {
+	return scrapAuditKeyPrefix
+}
+
+func scrapCacheKey(key string) string {
+	return scrapCacheKeyPrefix + ":" + key
+}
+
+func scrapProxyAssignKey(pool string) string {
+	return scrapProxyKeyPrefix + ":assign:" + pool
+}
+
+func scrapProxyHealthKey() string {
+	return scrapProxyKeyPrefix + ":health"
+}
+
+func scrapBlockKey(host string) string {
+	return scrapBlockKeyPrefix + ":" + host
+}
+
+func scrapRobotsKey(host string) string {
+	return scrapRobotsKeyPrefix + ":" + host
+}
+
+func scrapJobsKey(jobId string) string {
+	return scrapJobsKeyPrefix + ":" + jobId
+}
+
+func scrapSessionCookiesKey(host string) string {
+	return scrapSessionKeyPrefix + ":" + host + ":cookies"
+}
+
+func scrapHostKey(host string) string {
+	return scrapHostKeyPrefix + ":" + host
+}
+
+func scrapHostSlotKey(host string, slot int) string {
+	return scrapHostKey(host) + ":slot:" + strconv.Itoa(slot)
+}
+
+func scrapViewsKey(host string) string {
+	return scrapViewsKeyPrefix + ":" + host
+}
+
+func scrapChangesKey(host string) string {
+	return scrapChangesKeyPrefix + ":" + host
+}
+
+func scrapDueKey(host string) string {
+	return scrapDueKeyPrefix + ":" + host
+}
+
+func scrapRunsKey(scrapUrl string) string {
+	return scrapRunsKeyPrefix + ":" + scrapUrl
+}
+
+// field of the schedules hash with the runs of the schedule
+func scrapScheduleRunKey(id string) string {
+	return id + scheduleRunSuffix
+}
+
+func scrapJobsHostKey(host string) string {
+	return scrapJobsIndexKey + ":host:" + host
+}
+
+func scrapJobsStatusKey(status string) string {
+	return scrapJobsIndexKey + ":status:" + status
+}
+
+func scrapJobsKeyMeta(jobId string) string {
+	return scrapJobsKey(jobId) + ":meta"
+}
+
+func scrapJobsKeyPages(jobId string) string {
+	return scrapJobsKey(jobId) + ":pages"
+}
+
+func scrapJobsKeyPending(jobId string) string {
+	return scrapJobsKey(jobId) + ":pending"
 }
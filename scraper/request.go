@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// placeholder replaced by the page number in a templated request body
+	PagePlaceholder = "{{page}}"
+)
+
+// How to request the page of a selector, by default a GET without body
+type RequestSpec struct {
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty"`
+
+	// form body sent as application/x-www-form-urlencoded
+	Form map[string]string `json:"form,omitempty"`
+	// json body sent as application/json, it takes precedence over Form
+	Json json.RawMessage `json:"json,omitempty"`
+}
+
+func (r RequestSpec) method() string {
+	if r.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(r.Method)
+}
+
+func (r RequestSpec) hasBody() bool {
+	return len(r.Json) > 0 || len(r.Form) > 0
+}
+
+// the body and the content type for the request
+func (r RequestSpec) body() (io.Reader, string) {
+	if len(r.Json) > 0 {
+		return bytes.NewReader(r.Json), "application/json"
+	}
+	if len(r.Form) > 0 {
+		form := neturl.Values{}
+		for k, v := range r.Form {
+			form.Set(k, v)
+		}
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"
+	}
+	return nil, ""
+}
+
+// returns a copy of the request with the page number templated in the body,
+// the form field named pageParam is set and every PagePlaceholder is replaced
+func (r RequestSpec) withPage(pageParam string, page int) RequestSpec {
+	dup := r
+	p := strconv.Itoa(page)
+
+	if len(r.Form) > 0 {
+		dup.Form = make(map[string]string, len(r.Form))
+		for k, v := range r.Form {
+			dup.Form[k] = strings.Replace(v, PagePlaceholder, p, -1)
+		}
+		if pageParam != "" {
+			if _, ok := dup.Form[pageParam]; ok {
+				dup.Form[pageParam] = p
+			}
+		}
+	}
+
+	if len(r.Json) > 0 {
+		// "{{page}}" as a whole json value becomes a number
+		body := bytes.Replace(r.Json, []byte(`"`+PagePlaceholder+`"`), []byte(p), -1)
+		body = bytes.Replace(body, []byte(PagePlaceholder), []byte(p), -1)
+		dup.Json = json.RawMessage(body)
+	}
+
+	return dup
+}
+
+// the page goes in the body when the body refers to it
+func (r RequestSpec) pageInBody(pageParam string) bool {
+	if strings.Contains(string(r.Json), PagePlaceholder) {
+		return true
+	}
+	for k, v := range r.Form {
+		if k == pageParam || strings.Contains(v, PagePlaceholder) {
+			return true
+		}
+	}
+	return false
+}
+
+// headers carrying credentials
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+func (r RequestSpec) redacted() RequestSpec {
+	dup := r
+	if len(r.Cookies) > 0 {
+		dup.Cookies = make(map[string]string, len(r.Cookies))
+		for k, _ := range r.Cookies {
+			dup.Cookies[k] = redactedValue
+		}
+	}
+	if len(r.Headers) > 0 {
+		dup.Headers = make(map[string]string, len(r.Headers))
+		for k, v := range r.Headers {
+			dup.Headers[k] = v
+			for _, h := range credentialHeaders {
+				if strings.EqualFold(k, h) {
+					dup.Headers[k] = redactedValue
+				}
+			}
+		}
+	}
+	return dup
+}
+
+// the User-Agent the page of the selector is requested with
+func userAgentFor(selector ScrapSelector) (string, error) {
+	req, err := newRequest(selector)
+	if err != nil {
+		return "", err
+	}
+	return req.Header.Get("User-Agent"), nil
+}
+
+// identifies the request of the selector, the pages sent in the body share the url
+func requestKey(selector ScrapSelector) string {
+	if !selector.Request.hasBody() {
+		return selector.Url
+	}
+	body, _ := selector.Request.body()
+	b, _ := ioutil.ReadAll(body)
+	h := fnv.New64a()
+	h.Write([]byte(selector.Request.method()))
+	h.Write(b)
+	return fmt.Sprintf("%s#%x", selector.Url, h.Sum64())
+}
+
+// builds the http request for the selector
+func newRequest(selector ScrapSelector) (*http.Request, error) {
+	spec := selector.Request
+	body, contentType := spec.body()
+
+	profile, err := headerProfileFor(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(spec.method(), selector.Url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	profile.setHeaders(req)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for k, v := range spec.Headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range spec.Cookies {
+		req.AddCookie(&http.Cookie{Name: k, Value: v})
+	}
+
+	return req, nil
+}
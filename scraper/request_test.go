@@ -0,0 +1,145 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPaginatedRequestBody(t *testing.T) {
+	Convey("Paginated selector with the page in the body", t, func() {
+
+		Convey("form field named as the page param", func() {
+			s := ScrapSelector{
+				Url:       "http://www.test2.co.uk/search",
+				Base:      ".product-info",
+				PageParam: "page",
+				PageStart: 1,
+				PageIncr:  1,
+				PageLimit: 3,
+				Request: RequestSpec{
+					Method: "POST",
+					Form:   map[string]string{"page": "0", "q": "shoes"},
+				},
+			}
+
+			r := paginatedUrlSelector(s)
+			So(len(r), ShouldEqual, 2)
+			So(r[0].Url, ShouldEqual, "http://www.test2.co.uk/search")
+			So(r[0].Request.Form["page"], ShouldEqual, "1")
+			So(r[1].Request.Form["page"], ShouldEqual, "2")
+			So(r[1].Request.Form["q"], ShouldEqual, "shoes")
+			// the original selector is not modified
+			So(s.Request.Form["page"], ShouldEqual, "0")
+		})
+
+		Convey("json body with placeholders", func() {
+			s := ScrapSelector{
+				Url:       "http://www.test2.co.uk/api/search",
+				Base:      ".product-info",
+				PageParam: "offset",
+				PageStart: 0,
+				PageIncr:  20,
+				PageLimit: 40,
+				Request: RequestSpec{
+					Method: "POST",
+					Json:   json.RawMessage(`{"offset":"{{page}}","cursor":"p{{page}}"}`),
+				},
+			}
+
+			r := paginatedUrlSelector(s)
+			So(len(r), ShouldEqual, 2)
+			So(string(r[0].Request.Json), ShouldEqual, `{"offset":0,"cursor":"p0"}`)
+			So(string(r[1].Request.Json), ShouldEqual, `{"offset":20,"cursor":"p20"}`)
+			So(r[1].Url, ShouldEqual, "http://www.test2.co.uk/api/search")
+		})
+
+	})
+}
+
+func TestFromUrlWithRequestSpec(t *testing.T) {
+	Convey("Request the page using the method, headers, body and cookies of the selector", t, func() {
+		var method, lang, ua, cookie, body, contentType string
+
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method = r.Method
+			lang = r.Header.Get("Accept-Language")
+			ua = r.Header.Get("User-Agent")
+			contentType = r.Header.Get("Content-Type")
+			c, err := r.Cookie("currency")
+			if err == nil {
+				cookie = c.Value
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:  ts.URL,
+			Base: ".product-info",
+			Request: RequestSpec{
+				Method:  "post",
+				Headers: map[string]string{"Accept-Language": "de-DE"},
+				Cookies: map[string]string{"currency": "EUR"},
+				Form:    map[string]string{"country": "DE"},
+			},
+		}
+
+		snip, err := SnippetBase(s)
+		So(err, ShouldBeNil)
+		So(snip, ShouldContainSubstring, "Test")
+
+		So(method, ShouldEqual, "POST")
+		So(lang, ShouldEqual, "de-DE")
+		So(ua, ShouldEqual, defaultUserAgent)
+		So(cookie, ShouldEqual, "EUR")
+		So(contentType, ShouldEqual, "application/x-www-form-urlencoded")
+		So(body, ShouldEqual, "country=DE")
+	})
+}
+
+func TestPagesInBodyRecorded(t *testing.T) {
+	Convey("The pages sent in the body of the same url are recorded apart in the job", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:       ts.URL + "/search",
+			Base:      ".product-info",
+			PageParam: "page",
+			PageStart: 1,
+			PageIncr:  1,
+			PageLimit: 3,
+			Request: RequestSpec{
+				Method: "POST",
+				Form:   map[string]string{"page": "0"},
+			},
+		}
+
+		jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+		So(err, ShouldBeNil)
+		for _ = range items {
+		}
+
+		job, err := NewRedisScrapdata().ScrapJob(jobId)
+		So(err, ShouldBeNil)
+		pages := job["pages"].([]JobPageResult)
+		So(len(pages), ShouldEqual, 2)
+		So(pages[0].Url, ShouldEqual, s.Url)
+		So(pages[1].Url, ShouldEqual, s.Url)
+		So(job["meta"].(map[string]string)["pages:ok"], ShouldEqual, "2")
+	})
+}
@@ -0,0 +1,184 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	FetchErrorStatus = "status"
+)
+
+var (
+	defaultRetryPolicy RetryPolicy
+)
+
+func init() {
+	UseRetryPolicy(RetryPolicy{
+		MaxAttempts:     3,
+		BackoffMs:       500,
+		MaxBackoffMs:    30 * 1000,
+		MaxRetryAfterMs: 5 * 60 * 1000,
+		RetryStatus:     []int{408, 429, 500, 502, 503, 504},
+	})
+}
+
+// How many times and when a page is requested again after a failure
+type RetryPolicy struct {
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// exponential backoff with jitter, BackoffMs * 2^(attempt-1) up to MaxBackoffMs
+	BackoffMs    int `json:"backoffMs,omitempty"`
+	MaxBackoffMs int `json:"maxBackoffMs,omitempty"`
+	// a longer Retry-After fails the page instead of waiting
+	MaxRetryAfterMs int `json:"maxRetryAfterMs,omitempty"`
+	// http status codes requested again
+	RetryStatus []int `json:"retryStatus,omitempty"`
+}
+
+// default retry policy for all the selectors
+func UseRetryPolicy(p RetryPolicy) {
+	defaultRetryPolicy = p
+}
+
+func retryPolicyFor(selector ScrapSelector) RetryPolicy {
+	if selector.Retry == nil {
+		return defaultRetryPolicy
+	}
+
+	p := *selector.Retry
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryPolicy.MaxAttempts
+	}
+	if p.BackoffMs <= 0 {
+		p.BackoffMs = defaultRetryPolicy.BackoffMs
+	}
+	if p.MaxBackoffMs <= 0 {
+		p.MaxBackoffMs = defaultRetryPolicy.MaxBackoffMs
+	}
+	if p.MaxRetryAfterMs <= 0 {
+		p.MaxRetryAfterMs = defaultRetryPolicy.MaxRetryAfterMs
+	}
+	if p.RetryStatus == nil {
+		p.RetryStatus = defaultRetryPolicy.RetryStatus
+	}
+	return p
+}
+
+func (p RetryPolicy) retryStatus(status int) bool {
+	for _, s := range p.RetryStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// network errors, the retry status codes and the hosts in cool-down are retried
+func (p RetryPolicy) retryable(err error) bool {
+	if _, ok := err.(*neturl.Error); ok {
+		return true
+	}
+	fe, ok := err.(FetchError)
+	if !ok {
+		return false
+	}
+	if fe.Kind == FetchErrorCoolDown {
+		return true
+	}
+	return fe.Kind == FetchErrorStatus && p.retryStatus(fe.StatusCode)
+}
+
+// delay before the attempt number, starting at 1 for the first retry
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	max := time.Duration(p.MaxBackoffMs) * time.Millisecond
+	delay := time.Duration(p.BackoffMs) * time.Millisecond
+	for i := 1; i < attempt && delay < max; i++ {
+		delay = delay * 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// half fixed, half random
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// Retry-After in seconds or as a http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	t, err := http.ParseTime(value)
+	if err != nil || t.Before(now) {
+		return 0
+	}
+	return t.Sub(now)
+}
+
+// fetchs the page of the selector following the retry policy,
+// every attempt is recorded in the job meta
+func fromUrlWithRetry(ctx context.Context, jobId string, selector ScrapSelector) (*fetchedPage, error) {
+	policy := retryPolicyFor(selector)
+	rdata := NewRedisScrapdata()
+
+	var err error
+	var page *fetchedPage
+	attempt := 1
+	for ; ; attempt++ {
+		page, err = fromUrl(ctx, selector)
+		if jobId != "" {
+			rdata.JobAttempt(jobId, selector, attempt, err)
+		}
+		if err == nil {
+			if attempt > 1 {
+				log.Printf("INFO: Scrap [%s] %s succeeded after %v attempts", jobId, selector.Url, attempt)
+			}
+			break
+		}
+
+		if !policy.retryable(err) || attempt >= policy.MaxAttempts || ctx.Err() != nil {
+			break
+		}
+
+		delay := policy.backoff(attempt)
+		if fe, ok := err.(FetchError); ok && fe.RetryAfter > delay {
+			if fe.RetryAfter > time.Duration(policy.MaxRetryAfterMs)*time.Millisecond {
+				log.Printf("ERROR [%s] %s Retry-After %v is too long, give up", jobId, selector.Url, fe.RetryAfter)
+				break
+			}
+			delay = fe.RetryAfter
+		}
+
+		log.Printf("INFO: Scrap [%s] retry %s in %v, attempt %v failed with %v", jobId, selector.Url, delay, attempt, redactCredentials(err.Error()))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the pages of a cancelled job are not recorded
+	if jobId != "" && ctx.Err() == nil {
+		charset := ""
+		if err == nil {
+			charset = page.charset
+		}
+		rdata.JobPage(jobId, selector, attempt, charset, err)
+		if err == nil && page.cache != "" {
+			rdata.JobCache(jobId, page.cache)
+		}
+	}
+	return page, err
+}
@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	Convey("Exponential backoff with jitter", t, func() {
+		p := RetryPolicy{BackoffMs: 100, MaxBackoffMs: 1000}
+
+		So(p.backoff(1), ShouldBeBetweenOrEqual, 50*time.Millisecond, 100*time.Millisecond)
+		So(p.backoff(3), ShouldBeBetweenOrEqual, 200*time.Millisecond, 400*time.Millisecond)
+		So(p.backoff(10), ShouldBeBetweenOrEqual, 500*time.Millisecond, 1000*time.Millisecond)
+	})
+
+	Convey("Retry-After in seconds or http date", t, func() {
+		now := time.Date(2015, 1, 1, 10, 0, 0, 0, time.UTC)
+		So(parseRetryAfter("120", now), ShouldEqual, 2*time.Minute)
+		So(parseRetryAfter("Thu, 01 Jan 2015 10:00:30 GMT", now), ShouldEqual, 30*time.Second)
+		So(parseRetryAfter("nonsense", now), ShouldEqual, 0)
+	})
+}
+
+func newFlakyServer(failures int, status int) *httptest.Server {
+	var mu sync.Mutex
+	hits := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		hits++
+		fail := hits <= failures
+		mu.Unlock()
+
+		if fail {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(example1))
+	}))
+}
+
+func TestScrapWithRetries(t *testing.T) {
+	Convey("Failed pages are requested again following the retry policy", t, func() {
+		s := ScrapSelector{
+			Base:  ".product-info",
+			Id:    Selector{Exp: "h2[id]", Attr: "id"},
+			Retry: &RetryPolicy{MaxAttempts: 3, BackoffMs: 1, MaxBackoffMs: 5},
+		}
+
+		Convey("page that succeeds after retries", func() {
+			ts := newFlakyServer(2, http.StatusServiceUnavailable)
+			defer ts.Close()
+			s.Url = ts.URL + "/flaky.html"
+
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			count := 0
+			for _ = range items {
+				count++
+			}
+			So(count, ShouldEqual, 2)
+
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			meta := job["meta"].(map[string]string)
+			So(meta["attempts"], ShouldEqual, "3")
+			So(meta["pages:ok"], ShouldEqual, "1")
+			So(meta["pages:retried"], ShouldEqual, "1")
+
+			pages := job["pages"].([]JobPageResult)
+			So(pages[0].Attempts, ShouldEqual, 3)
+			So(pages[0].Status, ShouldEqual, "ok")
+			So(pages[0].AttemptErrors, ShouldResemble, []string{FetchErrorStatus, FetchErrorStatus})
+		})
+
+		Convey("page that fails permanently", func() {
+			ts := newFlakyServer(10, http.StatusBadGateway)
+			defer ts.Close()
+			s.Url = ts.URL + "/down.html"
+
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			_, opened := <-items
+			So(opened, ShouldBeFalse)
+
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			meta := job["meta"].(map[string]string)
+			So(meta["attempts"], ShouldEqual, "3")
+			So(meta["pages:failed"], ShouldEqual, "1")
+			So(meta["errors:"+FetchErrorStatus], ShouldEqual, "1")
+
+			pages := job["pages"].([]JobPageResult)
+			So(pages[0].Status, ShouldEqual, "failed")
+		})
+	})
+}
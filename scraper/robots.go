@@ -0,0 +1,298 @@
+package scraper
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FetchErrorRobots = "robots"
+
+	// robots.txt that could not be fetched because a server error is kept less time
+	robotsServerErrorTTL = 60 * 10
+	robotsMaxBytes       = 500 * 1024
+)
+
+var (
+	useRobots = true
+	robotsTTL = 60 * 60 * 24
+
+	// one robots.txt request at a time per host
+	robotsLocks   = map[string]*sync.Mutex{}
+	robotsLocksMu sync.Mutex
+)
+
+// enable or disable the robots.txt checks for all the selectors
+func UseRobots(enabled bool) {
+	useRobots = enabled
+}
+
+// seconds to keep a robots.txt cached in Redis
+func UseRobotsCacheTTL(seconds int) {
+	robotsTTL = seconds
+}
+
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRules struct {
+	groups []*robotsGroup
+	// all the urls are disallowed, robots.txt failed with a server error
+	disallowAll bool
+}
+
+func parseRobots(body string) *robotsRules {
+	rules := &robotsRules{}
+
+	var current *robotsGroup
+	// consecutive user-agent lines belong to the same group
+	agentsOpen := false
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "user-agent":
+			if !agentsOpen {
+				current = &robotsGroup{}
+				rules.groups = append(rules.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			agentsOpen = true
+			continue
+		case "allow", "disallow":
+			if current != nil && !(key == "disallow" && value == "") {
+				current.rules = append(current.rules, robotsRule{allow: key == "allow", path: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				delay, err := strconv.ParseFloat(value, 64)
+				if err == nil {
+					current.crawlDelay = time.Duration(delay * float64(time.Second))
+				}
+			}
+		}
+		agentsOpen = false
+	}
+
+	return rules
+}
+
+// the group for the user agent, the most specific agent wins over "*"
+func (r *robotsRules) group(userAgent string) *robotsGroup {
+	ua := strings.ToLower(userAgent)
+
+	var found *robotsGroup
+	matched := ""
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == "*" && found == nil {
+				found = g
+			}
+			if agent != "*" && strings.Contains(ua, agent) && len(agent) > len(matched) {
+				found = g
+				matched = agent
+			}
+		}
+	}
+	return found
+}
+
+func (r *robotsRules) allowed(userAgent string, u *neturl.URL) bool {
+	if r.disallowAll {
+		return false
+	}
+	g := r.group(userAgent)
+	if g == nil {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path = path + "?" + u.RawQuery
+	}
+
+	// the longest rule wins, and allow wins in a tie
+	allowed := true
+	longest := -1
+	for _, rule := range g.rules {
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > longest || (len(rule.path) == longest && rule.allow) {
+			longest = len(rule.path)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+func (r *robotsRules) crawlDelay(userAgent string) time.Duration {
+	g := r.group(userAgent)
+	if g == nil {
+		return 0
+	}
+	return g.crawlDelay
+}
+
+// robots.txt path pattern, supports the '*' wildcard and the '$' end anchor
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	exp := "^" + strings.Join(parts, ".*")
+	if anchored {
+		exp = exp + "$"
+	}
+
+	matched, err := regexp.MatchString(exp, path)
+	return err == nil && matched
+}
+
+// robots.txt rules for the host of the url, from Redis or fetched with the User-Agent
+func robotsFor(u *neturl.URL, userAgent string) (*robotsRules, error) {
+	rdata := NewRedisScrapdata()
+
+	cached, found, err := rdata.Robots(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return cached, nil
+	}
+
+	lock := robotsLock(u.Host)
+	lock.Lock()
+	defer lock.Unlock()
+
+	// other request could have fetched it while waiting for the lock
+	cached, found, err = rdata.Robots(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return cached, nil
+	}
+
+	robotsUrl := u.Scheme + "://" + u.Host + "/robots.txt"
+	req, err := http.NewRequest("GET", robotsUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	res, err := recordedClient(httpClient()).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, robotsMaxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case res.StatusCode >= 500:
+		log.Printf("ERROR: robots.txt for %s failed with status %v, disallow all", u.Host, res.StatusCode)
+		rdata.SaveRobots(u.Host, res.StatusCode, "", robotsServerErrorTTL)
+		return &robotsRules{disallowAll: true}, nil
+	case res.StatusCode >= 400:
+		// no robots.txt, everything is allowed
+		rdata.SaveRobots(u.Host, res.StatusCode, "", robotsTTL)
+		return parseRobots(""), nil
+	}
+
+	rdata.SaveRobots(u.Host, res.StatusCode, string(body), robotsTTL)
+	return parseRobots(string(body)), nil
+}
+
+func robotsLock(host string) *sync.Mutex {
+	robotsLocksMu.Lock()
+	defer robotsLocksMu.Unlock()
+
+	l, ok := robotsLocks[host]
+	if !ok {
+		l = &sync.Mutex{}
+		robotsLocks[host] = l
+	}
+	return l
+}
+
+// checks the robots.txt for the url of the selector and waits the crawl delay,
+// the rules are evaluated for the User-Agent the page is fetched with
+func checkRobots(ctx context.Context, selector ScrapSelector, userAgent string) error {
+	if !useRobots || selector.IgnoreRobots {
+		return nil
+	}
+
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return err
+	}
+
+	rules, err := robotsFor(u, userAgent)
+	if err != nil {
+		return err
+	}
+
+	if !rules.allowed(userAgent, u) {
+		return FetchError{Kind: FetchErrorRobots, Url: selector.Url, Msg: "disallowed by robots.txt"}
+	}
+
+	return waitCrawlDelay(ctx, u.Host, rules.crawlDelay(userAgent))
+}
+
+// sleeps until the host can be hit again or the context is done, the last hit
+// is shared by all the instances
+func waitCrawlDelay(ctx context.Context, host string, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	wait, err := NewRedisScrapdata().ReserveCrawlDelay(host, delay)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,159 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const robotsExample = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: gopherscraper
+User-agent: otherbot
+Disallow: /checkout
+Crawl-delay: 1.5
+`
+
+func robotsAllowed(rules *robotsRules, ua, u string) bool {
+	parsed, _ := neturl.Parse(u)
+	return rules.allowed(ua, parsed)
+}
+
+func TestParseRobots(t *testing.T) {
+	Convey("Rules from robots.txt", t, func() {
+		rules := parseRobots(robotsExample)
+
+		Convey("generic agent", func() {
+			So(robotsAllowed(rules, "somebot", "http://shop/products/1"), ShouldBeTrue)
+			So(robotsAllowed(rules, "somebot", "http://shop/private/1"), ShouldBeFalse)
+			So(robotsAllowed(rules, "somebot", "http://shop/private/public/1"), ShouldBeTrue)
+			So(robotsAllowed(rules, "somebot", "http://shop/docs/a.pdf"), ShouldBeFalse)
+			So(robotsAllowed(rules, "somebot", "http://shop/docs/a.pdf?x=1"), ShouldBeTrue)
+			So(rules.crawlDelay("somebot"), ShouldEqual, 0)
+		})
+
+		Convey("specific agent group wins", func() {
+			So(robotsAllowed(rules, "gopherscraper", "http://shop/private/1"), ShouldBeTrue)
+			So(robotsAllowed(rules, "gopherscraper", "http://shop/checkout?step=1"), ShouldBeFalse)
+			So(rules.crawlDelay("gopherscraper"), ShouldEqual, 1500*time.Millisecond)
+		})
+
+		Convey("empty robots.txt allows everything", func() {
+			So(robotsAllowed(parseRobots(""), "gopherscraper", "http://shop/private"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestScrapDisallowedByRobots(t *testing.T) {
+	Convey("Scrap skips the pages disallowed by robots.txt", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+				return
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:  ts.URL + "/private/list.html",
+			Base: ".product-info",
+			Id:   Selector{Exp: "h2[id]", Attr: "id"},
+		}
+
+		Convey("records the error in the job meta", func() {
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			_, opened := <-items
+			So(opened, ShouldBeFalse)
+
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			meta := job["meta"].(map[string]string)
+			So(meta["errors:"+FetchErrorRobots], ShouldEqual, "1")
+		})
+
+		Convey("the override is audited", func() {
+			s.IgnoreRobots = true
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			count := 0
+			for _ = range items {
+				count++
+			}
+			So(count, ShouldEqual, 2)
+
+			audit := NewRedisScrapdata().AuditLog()
+			So(audit[0], ShouldContainSubstring, jobId)
+			So(audit[0], ShouldContainSubstring, s.Url)
+		})
+	})
+}
+
+func TestRobotsUserAgent(t *testing.T) {
+	Convey("The robots.txt is evaluated for the User-Agent of the profile", t, func() {
+		var robotsAgent string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				robotsAgent = r.Header.Get("User-Agent")
+				w.Write([]byte("User-agent: firefox\nDisallow: /\n"))
+				return
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Url:     ts.URL + "/list.html",
+			Base:    ".product-info",
+			Id:      Selector{Exp: "h2[id]", Attr: "id"},
+			Profile: "firefox",
+		}
+		firefox, _ := headerProfile("firefox")
+
+		_, err := fromUrl(context.Background(), s)
+		So(fetchErrorKind(err), ShouldEqual, FetchErrorRobots)
+		So(robotsAgent, ShouldEqual, firefox.UserAgent)
+
+		s.Profile = "chrome"
+		_, err = fromUrl(context.Background(), s)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestRobotsRotatedProfile(t *testing.T) {
+	Convey("The robots.txt and the page use the same rotated profile", t, func() {
+		UseProfileRotation(ProfileRotationRequest)
+		defer UseProfileRotation(ProfileRotationNone)
+
+		for i := 0; i < 10; i++ {
+			var robotsAgent, pageAgent string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					robotsAgent = r.Header.Get("User-Agent")
+					http.NotFound(w, r)
+					return
+				}
+				pageAgent = r.Header.Get("User-Agent")
+				w.Write([]byte(example1))
+			}))
+
+			_, err := SnippetBase(ScrapSelector{Url: ts.URL + "/list.html", Base: ".product-info"})
+			ts.Close()
+			So(err, ShouldBeNil)
+			So(pageAgent, ShouldEqual, robotsAgent)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+const (
+	schedulerTick = 15 * time.Second
+
+	// the runs of a schedule are kept apart from it, so a run does not
+	// overwrite the schedule
+	scheduleRunSuffix = ":run"
+
+	// schedules fired faster than this are rejected
+	minScheduleInterval = 60
+)
+
+var (
+	ErrInvalidSchedule  = errors.New("Invalid schedule, it needs the url and a cron expression or an interval")
+	ErrScheduleNotFound = errors.New("Schedule not found")
+)
+
+// Recurring scrap of the selector saved for the url
+type Schedule struct {
+	Id string `json:"id"`
+	// selector saved for the url, the list selector by default
+	Url   string `json:"url"`
+	Stype string `json:"stype,omitempty"`
+
+	// cron expression with 5 fields, or the seconds between the runs
+	Cron            string `json:"cron,omitempty"`
+	IntervalSeconds int    `json:"intervalSeconds,omitempty"`
+	// random delay of the runs up to these seconds
+	JitterSeconds int `json:"jitterSeconds,omitempty"`
+	// location of the cron expression, UTC by default
+	Timezone string `json:"timezone,omitempty"`
+
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastJobId string     `json:"lastJobId,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	NextRun   time.Time  `json:"nextRun"`
+}
+
+// the fields of the schedule updated by its runs
+type scheduleRun struct {
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastJobId string     `json:"lastJobId,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+	NextRun   time.Time  `json:"nextRun"`
+}
+
+func (s Schedule) run() scheduleRun {
+	return scheduleRun{LastRun: s.LastRun, LastJobId: s.LastJobId, LastError: s.LastError, NextRun: s.NextRun}
+}
+
+func (s *Schedule) setRun(run scheduleRun) {
+	s.LastRun = run.LastRun
+	s.LastJobId = run.LastJobId
+	s.LastError = run.LastError
+	s.NextRun = run.NextRun
+}
+
+func validateSchedule(s Schedule) error {
+	if s.Url == "" || s.JitterSeconds < 0 {
+		return ErrInvalidSchedule
+	}
+	if (s.Cron == "") == (s.IntervalSeconds == 0) {
+		return ErrInvalidSchedule
+	}
+	if s.Cron == "" && s.IntervalSeconds < minScheduleInterval {
+		return ErrInvalidSchedule
+	}
+	if s.Cron != "" {
+		if _, err := parseCron(s.Cron); err != nil {
+			return ErrInvalidSchedule
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrInvalidSchedule
+	}
+	return nil
+}
+
+// the run after the given time, with the jitter
+func (s Schedule) nextRun(after time.Time) time.Time {
+	var next time.Time
+	if s.Cron != "" {
+		loc, _ := time.LoadLocation(s.Timezone)
+		c, _ := parseCron(s.Cron)
+		next = c.next(after.In(loc))
+	} else {
+		next = after.Add(time.Duration(s.IntervalSeconds) * time.Second)
+	}
+
+	if s.JitterSeconds > 0 && !next.IsZero() {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.JitterSeconds)+1)) * time.Second)
+	}
+	return next
+}
+
+// Scheduler fires the schedules saved in Redis, all the instances run it but
+// only the one holding the leader lock fires them
+type Scheduler struct {
+	Id    string
+	store ScrapAndStoreItems
+}
+
+func NewScheduler(store ScrapAndStoreItems) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		Id:    fmt.Sprintf("%s-%d", host, os.Getpid()),
+		store: store,
+	}
+}
+
+// runs until the context is done
+func (sc *Scheduler) Run(ctx context.Context) {
+	log.Printf("INFO: Scheduler [%s] started\n", sc.Id)
+	data := NewRedisScrapdata()
+	ttl := int(3 * schedulerTick / time.Second)
+
+	for {
+		if data.LeaderLock("scheduler", sc.Id, ttl) {
+			sc.fireDue(time.Now())
+		}
+
+		select {
+		case <-time.After(schedulerTick):
+		case <-ctx.Done():
+			log.Printf("INFO: Scheduler [%s] stopped\n", sc.Id)
+			return
+		}
+	}
+}
+
+// fires the schedules due at the given time, it returns how many were fired
+func (sc *Scheduler) fireDue(now time.Time) int {
+	data := NewRedisScrapdata()
+	schedules, err := data.Schedules()
+	if err != nil {
+		log.Printf("ERROR: Scheduler [%s] loading the schedules %v", sc.Id, err.Error())
+		return 0
+	}
+
+	fired := 0
+	for _, s := range schedules {
+		if s.NextRun.IsZero() || s.NextRun.After(now) {
+			continue
+		}
+		sc.fire(s, now)
+		fired++
+	}
+	return fired
+}
+
+// scraps the selector of the schedule, the missed runs are fired only once
+func (sc *Scheduler) fire(s Schedule, now time.Time) {
+	data := NewRedisScrapdata()
+
+	s.LastRun = &now
+	s.LastJobId = ""
+	s.LastError = ""
+	s.NextRun = s.nextRun(now)
+
+	selector, err := data.Selector(s.Url, s.Stype)
+	if err == nil {
+		s.LastJobId, err = sc.store.ScrapAndStore(selector)
+	}
+	if err != nil {
+		log.Printf("ERROR: Scheduler [%s] schedule %s for %s failed with %v", sc.Id, s.Id, s.Url, err.Error())
+		s.LastError = err.Error()
+	} else {
+		log.Printf("INFO: Scheduler [%s] schedule %s started job %s, next run %v", sc.Id, s.Id, s.LastJobId, s.NextRun)
+	}
+
+	err = data.SaveScheduleRun(s)
+	if err == ErrScheduleNotFound {
+		log.Printf("INFO: Scheduler [%s] schedule %s was deleted while it was fired", sc.Id, s.Id)
+	}
+}
+
+type byNextRun []Schedule
+
+func (a byNextRun) Len() int           { return len(a) }
+func (a byNextRun) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byNextRun) Less(i, j int) bool { return a[i].NextRun.Before(a[j].NextRun) }
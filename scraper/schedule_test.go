@@ -0,0 +1,129 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordedScrapAndStore struct {
+	selectors *[]ScrapSelector
+}
+
+func (r recordedScrapAndStore) ScrapAndStore(selector ScrapSelector) (string, error) {
+	*r.selectors = append(*r.selectors, selector)
+	return NewJobId("D"), nil
+}
+
+func (r recordedScrapAndStore) ResumeAndStore(jobId string) error {
+	return nil
+}
+
+func (r recordedScrapAndStore) ScrapPagesAndStore(jobId string, selector ScrapSelector, pages []ScrapSelector) error {
+	*r.selectors = append(*r.selectors, pages...)
+	return nil
+}
+
+func TestSchedules(t *testing.T) {
+	rdata := NewRedisScrapdata()
+
+	Convey("The schedules are validated and saved with the next run", t, func() {
+		for _, s := range []Schedule{
+			{Cron: "0 4 * * *"},
+			{Url: "http://www.shop.com/list"},
+			{Url: "http://www.shop.com/list", Cron: "0 4 * * *", IntervalSeconds: 3600},
+			{Url: "http://www.shop.com/list", IntervalSeconds: 10},
+			{Url: "http://www.shop.com/list", Cron: "0 25 * * *"},
+			{Url: "http://www.shop.com/list", Cron: "0 4 * * *", Timezone: "Mars/Olympus"},
+		} {
+			_, err := rdata.SaveSchedule(s)
+			So(err, ShouldEqual, ErrInvalidSchedule)
+		}
+
+		s, err := rdata.SaveSchedule(Schedule{Url: "http://www.shop.com/list", IntervalSeconds: 3600, JitterSeconds: 60})
+		So(err, ShouldBeNil)
+		defer rdata.DeleteSchedule(s.Id)
+		So(s.Id, ShouldStartWith, "S")
+		So(s.NextRun, ShouldHappenBetween, time.Now().Add(59*time.Minute), time.Now().Add(62*time.Minute))
+
+		saved, err := rdata.Schedule(s.Id)
+		So(err, ShouldBeNil)
+		So(saved.IntervalSeconds, ShouldEqual, 3600)
+
+		So(rdata.DeleteSchedule(s.Id), ShouldBeNil)
+		_, err = rdata.Schedule(s.Id)
+		So(err, ShouldEqual, ErrScheduleNotFound)
+		So(rdata.DeleteSchedule(s.Id), ShouldEqual, ErrScheduleNotFound)
+	})
+
+	Convey("The scheduler fires the schedules due", t, func() {
+		err := rdata.SaveSelector(ScrapSelector{Url: "http://www.shop.com/list", Base: ".product"})
+		So(err, ShouldBeNil)
+
+		daily, _ := rdata.SaveSchedule(Schedule{Url: "http://www.shop.com/list", Cron: "30 4 * * *", Timezone: "Europe/London"})
+		hourly, _ := rdata.SaveSchedule(Schedule{Url: "http://www.other.com/list", IntervalSeconds: 3600})
+		defer rdata.DeleteSchedule(daily.Id)
+		defer rdata.DeleteSchedule(hourly.Id)
+
+		var selectors []ScrapSelector
+		sc := NewScheduler(recordedScrapAndStore{&selectors})
+
+		So(sc.fireDue(time.Now()), ShouldEqual, 0)
+
+		// missed runs are fired once
+		later := daily.NextRun.Add(48 * time.Hour)
+		So(sc.fireDue(later), ShouldEqual, 2)
+		So(len(selectors), ShouldEqual, 1)
+		So(selectors[0].Base, ShouldEqual, ".product")
+
+		daily, _ = rdata.Schedule(daily.Id)
+		So(daily.LastJobId, ShouldStartWith, "D")
+		So(daily.LastRun.Equal(later), ShouldBeTrue)
+		So(daily.NextRun.After(later), ShouldBeTrue)
+		london, _ := time.LoadLocation("Europe/London")
+		So(daily.NextRun.In(london).Format("15:04"), ShouldEqual, "04:30")
+
+		// without a selector saved for the url
+		hourly, _ = rdata.Schedule(hourly.Id)
+		So(hourly.LastError, ShouldEqual, ErrSelectorNotFound.Error())
+		So(hourly.NextRun, ShouldResemble, later.Add(time.Hour))
+
+		So(sc.fireDue(later), ShouldEqual, 0)
+	})
+
+	Convey("A run updates only the run fields of the schedule", t, func() {
+		var selectors []ScrapSelector
+		sc := NewScheduler(recordedScrapAndStore{&selectors})
+		fired, _ := rdata.SaveSchedule(Schedule{Url: "http://www.shop.com/list", IntervalSeconds: 3600})
+		defer rdata.DeleteSchedule(fired.Id)
+
+		// changed while it was fired
+		changed := fired
+		changed.IntervalSeconds = 7200
+		rdata.SaveSchedule(changed)
+
+		now := time.Now()
+		sc.fire(fired, now)
+		saved, err := rdata.Schedule(fired.Id)
+		So(err, ShouldBeNil)
+		So(saved.IntervalSeconds, ShouldEqual, 7200)
+		So(saved.LastRun.Equal(now), ShouldBeTrue)
+
+		// deleted while it was fired
+		So(rdata.DeleteSchedule(fired.Id), ShouldBeNil)
+		sc.fire(fired, now)
+		_, err = rdata.Schedule(fired.Id)
+		So(err, ShouldEqual, ErrScheduleNotFound)
+		all, _ := rdata.Schedules()
+		for _, s := range all {
+			So(s.Id, ShouldNotEqual, fired.Id)
+		}
+	})
+
+	Convey("Only one instance holds the leader lock", t, func() {
+		So(rdata.LeaderLock("test", "a", 10), ShouldBeTrue)
+		So(rdata.LeaderLock("test", "b", 10), ShouldBeFalse)
+		So(rdata.LeaderLock("test", "a", 10), ShouldBeTrue)
+	})
+}
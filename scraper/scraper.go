@@ -2,8 +2,8 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"log"
 	"net"
@@ -71,6 +71,51 @@ type ScrapSelector struct {
 
 	// comma separated fixed tags
 	ScrapTags string `json:"scrapTags,omitempty"`
+
+	// method, headers, body and cookies to request the page
+	Request RequestSpec `json:"request,omitempty"`
+
+	// scrap even if robots.txt disallows it, every use is audited
+	IgnoreRobots bool `json:"ignoreRobots,omitempty"`
+
+	// limits for the host while scraping with this selector
+	Politeness *Politeness `json:"politeness,omitempty"`
+
+	// how to retry the failed pages, by default the global retry policy
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// checks to the response before scraping it, by default the global validation
+	Validation *ResponseValidation `json:"validation,omitempty"`
+
+	// how to detect the host is blocking us, by default the global block detection
+	Block *BlockDetection `json:"block,omitempty"`
+
+	// name of the proxy pool, by default the "default" pool if any, "direct" skips the proxies
+	ProxyPool string `json:"proxyPool,omitempty"`
+
+	// name of the header profile, by default the host profile or the rotation
+	Profile string `json:"profile,omitempty"`
+
+	// charset of the pages, by default it is detected
+	Charset string `json:"charset,omitempty"`
+
+	// how the id is generated when the id selector matches nothing, by default the global fallback,
+	// the fields are used by the "fields" fallback
+	IdFallback       string   `json:"idFallback,omitempty"`
+	IdFallbackFields []string `json:"idFallbackFields,omitempty"`
+
+	// always download the page, without revalidating the cached copy
+	NoCache bool `json:"noCache,omitempty"`
+
+	// which redirects are followed, by default the global redirect policy
+	Redirect *RedirectPolicy `json:"redirect,omitempty"`
+}
+
+// copy of the selector without credentials, safe to be returned by the API
+func (s ScrapSelector) Redacted() ScrapSelector {
+	dup := s
+	dup.Request = s.Request.redacted()
+	return dup
 }
 
 type Selector struct {
@@ -88,12 +133,36 @@ type ItemResult struct {
 	JobId string
 	Item  model.Item
 	Err   error
+	// header profile used to fetch the page
+	Profile string
+	// the page was not modified since the last scrap with the same selector
+	Unchanged bool
+	// the item is indexed by the final url of the page, after the redirects
+	IndexFinalUrl bool
+}
+
+// Error fetching a page, it is recorded in the job meta by Kind
+type FetchError struct {
+	Kind       string
+	Url        string
+	StatusCode int
+	Msg        string
+	// wait requested by the server before trying again
+	RetryAfter time.Duration
+}
+
+func (e FetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("FetchError: [%s] %s [%v] %s", e.Kind, e.Url, e.StatusCode, e.Msg)
+	}
+	return fmt.Sprintf("FetchError: [%s] %s %s", e.Kind, e.Url, e.Msg)
 }
 
 // Scrap a website looking for items based on the CSS selector
-// and returns the jobId, a channel with the Items scrapperd, or an error
+// and returns the jobId, a channel with the Items scrapperd, or an error.
+// The job stops when the context is done or the job is cancelled
 type ScrapperItems interface {
-	Scrap(selector ScrapSelector) (string, chan ItemResult, error)
+	Scrap(ctx context.Context, selector ScrapSelector) (string, chan ItemResult, error)
 }
 
 type DefaultScrapper struct {
@@ -105,7 +174,7 @@ func NewScrapper() ScrapperItems {
 
 // DefaultScrapper Scraps a Web looking for items, if the selector has multiple pages
 // it does the scrap in all the pages concurrently
-func (d DefaultScrapper) Scrap(selector ScrapSelector) (string, chan ItemResult, error) {
+func (d DefaultScrapper) Scrap(ctx context.Context, selector ScrapSelector) (string, chan ItemResult, error) {
 	wg := &sync.WaitGroup{}
 	err := validateSelector(selector)
 	if err != nil {
@@ -114,48 +183,102 @@ func (d DefaultScrapper) Scrap(selector ScrapSelector) (string, chan ItemResult,
 
 	items := make(chan ItemResult, bufferItemsSize)
 
-	jobId := "D" + GenerateStringKey(selector)
-	log.Printf("INFO: Scrap [%s] started\n", jobId)
+	ctx, jobId, started := scrapJob(ctx, "D", selector)
+	if started {
+		log.Printf("INFO: Scrap [%s] started\n", jobId)
+	}
 	data := NewRedisScrapdata()
-	data.StartJob(jobId, selector)
 
 	pages := paginatedUrlSelector(selector)
 
+	// the pages are pending in the job until they are scraped
+	for i, _ := range pages {
+		data.AddPendingPage(jobId, pendingPage(pages[i]))
+	}
+
 	wg.Add(len(pages))
 	for i, _ := range pages {
-		go doScrapFromUrl(jobId, pages[i], items, wg)
+		go doScrapFromUrl(ctx, jobId, pages[i], items, wg)
 	}
 
-	go closeItemsChannel(jobId, items, wg)
+	if started {
+		go closeItemsChannel(ctx, jobId, items, wg)
+	} else {
+		go closePageItems(items, wg)
+	}
 
 	return jobId, items, err
 }
 
-func doScrapFromUrl(jobId string, s ScrapSelector, items chan ItemResult, wg *sync.WaitGroup) {
+func doScrapFromUrl(ctx context.Context, jobId string, s ScrapSelector, items chan ItemResult, wg *sync.WaitGroup) {
 	defer wg.Done()
+	// a paused job keeps the page pending
+	if jobStopped(ctx) {
+		return
+	}
 	log.Printf("INFO: Scrap [%s] GET from %s ", jobId, s.Url)
 
-	doc, err := fromUrl(s)
+	data := NewRedisScrapdata()
+	pending := pendingPage(s)
+
+	var page *fetchedPage
+	s, err := withHeaderProfile(s)
+	if err == nil {
+		page, err = fromUrlWithRetry(ctx, jobId, s)
+	}
+	// the pages not fetched by a cancelled or paused job are not errors
+	if ctx.Err() != nil {
+		log.Printf("INFO: Scrap [%s] stopped GET from %s ", jobId, s.Url)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR [%s] Scrapping %v with message %v", jobId, s.Url, err.Error())
+		log.Printf("ERROR [%s] Scrapping %v with message %v", jobId, s.Url, redactCredentials(err.Error()))
+		data.JobError(jobId, err)
+		data.DonePendingPage(jobRoot(ctx), pending)
 		return
 	}
-	DocumentScrap(jobId, s, doc, items)
+	page.detectBlocks = !testScrap(ctx)
+	documentScrap(ctx, jobId, s, page, items)
+	// the items not sent are scraped again when the job is resumed
+	if ctx.Err() != nil {
+		return
+	}
+	data.DonePendingPage(jobRoot(ctx), pending)
 	log.Printf("INFO: Scrap [%s] FINISH SCRAP Request from %s ", jobId, s.Url)
 
 }
 
-func closeItemsChannel(jobId string, items chan ItemResult, wg *sync.WaitGroup) {
+func closeItemsChannel(ctx context.Context, jobId string, items chan ItemResult, wg *sync.WaitGroup) {
 	wg.Wait()
+	cause := context.Cause(ctx)
+	releaseJob(ctx, jobId)
 	close(items)
-	log.Printf("INFO: Scrap [%s] finished\n", jobId)
+
 	data := NewRedisScrapdata()
+	switch {
+	case cause == errJobPaused:
+		log.Printf("INFO: Scrap [%s] paused\n", jobId)
+		// the paused job is not finished, it could be resumed already
+		return
+	case cause != nil:
+		log.Printf("INFO: Scrap [%s] cancelled\n", jobId)
+		data.CancelJob(jobId)
+	default:
+		log.Printf("INFO: Scrap [%s] finished\n", jobId)
+	}
 	data.FinishJob(jobId)
 }
 
+// the pages scraped in a job started by another scrap, the job finishes with that one
+func closePageItems(items chan ItemResult, wg *sync.WaitGroup) {
+	wg.Wait()
+	close(items)
+}
+
 // You can use a custom http.Client calling this function before doing any scrapping
 func UseHttpClient(client *http.Client) {
 	defaultHttpClient = client
+	resetProxyClients()
 }
 
 // You can set the timeout for the standard http.Client before doing any scrapping
@@ -172,33 +295,152 @@ func UseHttpClientWithTimeout(timeout time.Duration) {
 	}
 
 	defaultHttpClient = &client
+	resetProxyClients()
 }
 
-// set a custom Agent for the scraper
+// set a custom Agent for the scraper, it is the User-Agent of the default profile
 func UseUserAgent(ua string) {
 	defaultUserAgent = ua
+	UseHeaderProfile(HeaderProfile{Name: DefaultHeaderProfile, UserAgent: ua})
 }
 
 func httpClient() *http.Client {
 	return defaultHttpClient
 }
 
-func fromUrl(selector ScrapSelector) (*goquery.Document, error) {
+func fromUrl(ctx context.Context, selector ScrapSelector) (*fetchedPage, error) {
+	err := checkCoolDown(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent, err := userAgentFor(selector)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRobots(ctx, selector, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	politeness, err := politenessFor(selector)
+	if err != nil {
+		return nil, err
+	}
+	releaseHost, err := acquireHost(ctx, politeness)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseHost()
+
+	choice, err := clientFor(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := fetchDocument(ctx, selector, recordedClient(choice.client))
+	err = unwrapRedirectError(err)
+	choice.done(err)
+	detectBlock(selector, err)
+
+	return page, err
+}
+
+func fetchDocument(ctx context.Context, selector ScrapSelector, client *http.Client) (*fetchedPage, error) {
 	lockLimitConnections()
 	defer unlockLimitConnections()
 
-	req, err := http.NewRequest("GET", selector.Url, nil)
+	session, err := sessionFor(selector.Url)
+	if err != nil {
+		return nil, err
+	}
+	if session != nil {
+		return sessionFromUrl(ctx, session, selector, client)
+	}
+
+	req, err := newRequest(selector)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	req.Header.Add("User-Agent", defaultUserAgent)
+	client = redirectClient(selector, client)
+	if cacheable(selector) {
+		return fetchCached(selector, client, req)
+	}
 
-	res, err := httpClient().Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	return goquery.NewDocumentFromResponse(res)
+	page, _, err := pageFromResponse(selector, res)
+	return page, err
+}
+
+// validates and parses the response, the status codes to retry
+// and the responses not valid are returned as FetchError,
+// the body is returned as it was received
+func pageFromResponse(selector ScrapSelector, res *http.Response) (*fetchedPage, []byte, error) {
+	defer res.Body.Close()
+
+	if retryPolicyFor(selector).retryStatus(res.StatusCode) {
+		return nil, nil, FetchError{
+			Kind:       FetchErrorStatus,
+			Url:        selector.Url,
+			StatusCode: res.StatusCode,
+			Msg:        res.Status,
+			RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	validation := validationFor(selector)
+	err := decodeBody(res, validation.MaxBodyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = validation.validateResponse(selector.Url, res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err := validation.readBody(selector.Url, res)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, charset, err := decodeCharset(selector, raw, res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	doc.Url = res.Request.URL
+
+	err = blockDetectionFor(selector).blockedDocument(selector.Url, res.StatusCode, doc, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = validation.validateDocument(selector.Url, res.StatusCode, doc, body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = archivePage(selector, time.Now(), raw)
+	if err != nil {
+		log.Printf("ERROR: Archive %s failed with message %v", selector.Url, err.Error())
+	}
+	page := &fetchedPage{
+		Document:  doc,
+		charset:   charset,
+		finalUrl:  res.Request.URL.String(),
+		redirects: redirectChain(res),
+	}
+	return page, raw, nil
 }
 
 // acts as a lock to limit the number of concurrent connections
@@ -223,7 +465,7 @@ func validateSelector(selector ScrapSelector) error {
 		return ErrInvalidSelector
 	}
 
-	return nil
+	return validateIdFallback(selector)
 
 }
 
@@ -233,8 +475,16 @@ func paginatedUrlSelector(selector ScrapSelector) []ScrapSelector {
 		return []ScrapSelector{selector}
 	}
 
+	pageInBody := selector.Request.pageInBody(selector.PageParam)
+
 	for i := selector.PageStart; i < selector.PageLimit; i = i + selector.PageIncr {
 		dup := selector
+		if pageInBody {
+			dup.Request = selector.Request.withPage(selector.PageParam, i)
+			pages = append(pages, dup)
+			continue
+		}
+
 		// change page parameter and re-encode
 		url, _ := neturl.Parse(dup.Url)
 		q := url.Query()
@@ -266,7 +516,7 @@ type RecursiveScrapper struct {
 // 2) For each item follow the link
 // 3) Get the detail Selector from Redis related with the item scraped
 // 4) Scrap the detail page
-func (rs RecursiveScrapper) Scrap(selector ScrapSelector) (string, chan ItemResult, error) {
+func (rs RecursiveScrapper) Scrap(ctx context.Context, selector ScrapSelector) (string, chan ItemResult, error) {
 	wg := &sync.WaitGroup{}
 
 	selector, err := rs.selectorFromRedis(selector)
@@ -279,41 +529,58 @@ func (rs RecursiveScrapper) Scrap(selector ScrapSelector) (string, chan ItemResu
 		return "", nil, err
 	}
 
-	baseJobId, itemsIn, err := rs.baseScrapper.Scrap(selector)
-	if err != nil {
-		return baseJobId, nil, err
+	if !selector.Recursive {
+		return rs.baseScrapper.Scrap(ctx, selector)
 	}
 
-	if !selector.Recursive {
-		return baseJobId, itemsIn, err
+	// the base and the detail pages are scraped in the recursive job
+	ctx, recJobId, started := scrapJob(ctx, "R", selector)
+	if started {
+		log.Printf("INFO: Scrap [%v] Recursive started\n", recJobId)
 	}
 
-	itemsOut := make(chan ItemResult, bufferItemsSize)
+	_, itemsIn, err := rs.baseScrapper.Scrap(ctx, selector)
+	if err != nil {
+		if started {
+			releaseJob(ctx, recJobId)
+			NewRedisScrapdata().FinishJob(recJobId)
+		}
+		return recJobId, nil, err
+	}
 
-	recJobId := "R" + GenerateStringKey(selector)
-	log.Printf("INFO: Scrap [%v] Recursive started\n", recJobId)
-	data := NewRedisScrapdata()
-	data.StartJob(recJobId, selector)
+	itemsOut := make(chan ItemResult, bufferItemsSize)
 
 	wg.Add(1)
-	go rs.ScrapAllRecursiveItems(recJobId, selector, itemsIn, itemsOut, wg)
-	go closeItemsChannel(recJobId, itemsOut, wg)
+	go rs.ScrapAllRecursiveItems(ctx, recJobId, selector, itemsIn, itemsOut, wg)
+	if started {
+		go closeItemsChannel(ctx, recJobId, itemsOut, wg)
+	} else {
+		go closePageItems(itemsOut, wg)
+	}
 
 	return recJobId, itemsOut, err
 
 }
 
-func (rs RecursiveScrapper) ScrapAllRecursiveItems(jobId string, selector ScrapSelector, inItems chan ItemResult, outItems chan ItemResult, wg *sync.WaitGroup) {
+func (rs RecursiveScrapper) ScrapAllRecursiveItems(ctx context.Context, jobId string, selector ScrapSelector, inItems chan ItemResult, outItems chan ItemResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	for it := range inItems {
+		// drains the base items without spawning more children,
+		// the links of a paused job are kept to be resumed
+		if ctx.Err() != nil {
+			if context.Cause(ctx) == errJobPaused {
+				rs.keepPendingLink(ctx, it, selector)
+			}
+			continue
+		}
 		wg.Add(1)
-		go rs.scrapItemRecursive(jobId, it, selector, outItems, wg)
+		go rs.scrapItemRecursive(ctx, jobId, it, selector, outItems, wg)
 	}
 
 }
 
-func (rs RecursiveScrapper) scrapItemRecursive(jobId string, it ItemResult, selector ScrapSelector, itemsChan chan ItemResult, wg *sync.WaitGroup) {
+func (rs RecursiveScrapper) scrapItemRecursive(ctx context.Context, jobId string, it ItemResult, selector ScrapSelector, itemsChan chan ItemResult, wg *sync.WaitGroup) {
 	defer wg.Done()
 	rselector, err := rs.recursiveSelector(it, selector)
 	if err != nil {
@@ -321,7 +588,7 @@ func (rs RecursiveScrapper) scrapItemRecursive(jobId string, it ItemResult, sele
 		return
 	}
 
-	_, itemsRec, err := rs.Scrap(rselector)
+	_, itemsRec, err := rs.Scrap(ctx, rselector)
 	if err != nil {
 		log.Println("ERROR: RecursiveScrapper:Scrap there is a problem with the Selector", err.Error())
 		return
@@ -330,11 +597,19 @@ func (rs RecursiveScrapper) scrapItemRecursive(jobId string, it ItemResult, sele
 	for i := range itemsRec {
 		// overwrite the jobid to reflect the parent job
 		i.JobId = jobId
-		itemsChan <- i
+		sendItem(ctx, itemsChan, i)
 	}
 
 }
 
+func (rs RecursiveScrapper) keepPendingLink(ctx context.Context, it ItemResult, selector ScrapSelector) {
+	rselector, err := rs.recursiveSelector(it, selector)
+	if err != nil {
+		return
+	}
+	NewRedisScrapdata().AddPendingPage(jobRoot(ctx), pendingPage(rselector))
+}
+
 func (rs RecursiveScrapper) selectorFromRedis(s ScrapSelector) (ScrapSelector, error) {
 	// if selector not empty just use it
 	if s.Base != "" {
@@ -386,7 +661,7 @@ func ScrapperFromReader(r io.Reader) ScrapperItems {
 	return FromReaderScrapper{&r}
 }
 
-func (s FromReaderScrapper) Scrap(selector ScrapSelector) (string, chan ItemResult, error) {
+func (s FromReaderScrapper) Scrap(ctx context.Context, selector ScrapSelector) (string, chan ItemResult, error) {
 	var wg sync.WaitGroup
 
 	err := validateSelector(selector)
@@ -394,8 +669,9 @@ func (s FromReaderScrapper) Scrap(selector ScrapSelector) (string, chan ItemResu
 		return "", nil, err
 	}
 
-	jobId := "READER" + GenerateStringKey(selector)
+	jobId := NewJobId("READER")
 	log.Printf("INFO: Scrap [%v] from Reader started\n", jobId)
+	ctx = jobContext(ctx, jobId)
 
 	items := make(chan ItemResult, bufferItemsSize)
 	wg.Add(1)
@@ -406,18 +682,40 @@ func (s FromReaderScrapper) Scrap(selector ScrapSelector) (string, chan ItemResu
 			log.Println("ERROR Scrapping ", selector.Url, " with message", err.Error())
 			return
 		}
-		DocumentScrap(jobId, selector, doc, items)
+		documentScrap(ctx, jobId, selector, &fetchedPage{Document: doc}, items)
 		wg.Done()
 	}()
 
-	closeItemsChannel(jobId, items, &wg)
+	closeItemsChannel(ctx, jobId, items, &wg)
 
 	return jobId, items, nil
 }
 
 // Scrapping logic from the document
 func DocumentScrap(jobId string, selector ScrapSelector, doc *goquery.Document, items chan ItemResult) {
+	documentScrap(context.Background(), jobId, selector, &fetchedPage{Document: doc}, items)
+}
+
+func documentScrap(ctx context.Context, jobId string, selector ScrapSelector, page *fetchedPage, items chan ItemResult) {
 	rdata := NewRedisScrapdata()
+	indexFinalUrl := redirectPolicyFor(selector).IndexFinalUrl
+
+	// the relative links are from the final url
+	pageUrl := selector.Url
+	if page.finalUrl != "" {
+		pageUrl = page.finalUrl
+	}
+
+	normalizer, err := urlNormalizerFor(pageUrl)
+	if err != nil {
+		log.Printf("ERROR: Scrap [%s] url rules for %s failed with message %v", jobId, pageUrl, err.Error())
+	}
+	canonical := normalizer.canonical(page.Document, pageUrl)
+
+	idSelector := selector
+	if indexFinalUrl {
+		idSelector.Url = canonical
+	}
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -426,17 +724,26 @@ func DocumentScrap(jobId string, selector ScrapSelector, doc *goquery.Document,
 		}
 	}()
 
-	sel := doc.Find(selector.Base)
+	sel := page.Find(selector.Base)
+	if page.detectBlocks {
+		detectZeroMatches(selector, sel.Length())
+	}
 	for i := range sel.Nodes {
 		s := sel.Eq(i)
-		var err error
 		item := model.Item{}
-		item.ScrapUrl = selector.Url
+		item.ScrapUrl = normalizer.normalize(nil, selector.Url)
 		item.ScrapTags = selector.ScrapTags
-
-		item.Link = SanitizeURL(item.ScrapUrl, extractText(s, selector.Link), selector.LinkPathLimit)
-		item.Id, err = extractId(s, selector, item.Link)
-		item.Image = SanitizeURL(item.ScrapUrl, extractText(s, selector.Image), 0)
+		item.FinalUrl = page.finalUrl
+		item.Redirects = page.redirects
+		item.CanonicalUrl = canonical
+
+		// a detail page is the link of its item
+		item.Link = canonical
+		if link := extractText(s, selector.Link); link != "" {
+			item.Link = normalizer.sanitize(pageUrl, link, selector.LinkPathLimit)
+		}
+		id, err := extractNakedId(s, idSelector, item.Link)
+		item.Image = normalizer.sanitize(pageUrl, extractText(s, selector.Image), 0)
 		item.Title = extractText(s, selector.Title)
 		item.Description = extractText(s, selector.Description)
 		item.Price = extractFloat(s, selector.Price)
@@ -444,25 +751,31 @@ func DocumentScrap(jobId string, selector ScrapSelector, doc *goquery.Document,
 		item.Stars = extractFloat(s, selector.Stars)
 		item.Categories = extractText(s, selector.Categories)
 
+		// the items without id would be dropped by the storages
+		if err == nil && strings.TrimSpace(id) == "" {
+			id = fallbackId(s, selector, item)
+		}
+		if err == nil {
+			item.Id = selector.IdPrefix + id
+		}
+
 		item.LastScrap = time.Now().Format(time.RFC3339)
 
-		items <- ItemResult{
-			JobId: jobId,
-			Item:  item,
-			Err:   err,
+		sent := sendItem(ctx, items, ItemResult{
+			JobId:         jobId,
+			Item:          item,
+			Err:           err,
+			Profile:       selector.Profile,
+			Unchanged:     page.unchanged,
+			IndexFinalUrl: indexFinalUrl,
+		})
+		if !sent {
+			return
 		}
 	}
 
 }
 
-func extractId(s *goquery.Selection, selector ScrapSelector, link string) (string, error) {
-	id, err := extractNakedId(s, selector, link)
-	if err != nil {
-		return "", err
-	}
-	return selector.IdPrefix + id, nil
-}
-
 func extractNakedId(s *goquery.Selection, selector ScrapSelector, link string) (string, error) {
 	if selector.IdFrom == SelectorIdFromUrl {
 		return ExtractIdFromURL(selector.Url, selector.IdExtractor.UrlPathIndex, selector.IdExtractor.SplitString, selector.IdExtractor.SplitIndex)
@@ -475,51 +788,22 @@ func extractNakedId(s *goquery.Selection, selector ScrapSelector, link string) (
 }
 
 func SnippetBase(selector ScrapSelector) (string, error) {
-	doc, err := fromUrl(selector)
+	// the robots.txt and the page use the same profile
+	selector, err := withHeaderProfile(selector)
 	if err != nil {
 		return "", err
 	}
-	return baseSelectorSnip(selector, doc)
-
-}
-
-func SanitizeURL(scrapUrl, url string, linkLimit int) string {
-	if url == "" {
-		return scrapUrl
-	}
-
-	surl, err := neturl.Parse(scrapUrl)
-	if err != nil {
-		return url
-	}
-
-	purl, err := neturl.Parse(strings.Trim(url, " \t\r\n"))
+	page, err := fromUrlWithRetry(context.Background(), "", selector)
 	if err != nil {
-		return url
-	}
-
-	// delete sid
-	q := purl.Query()
-	q.Del("sid")
-	purl.RawQuery = q.Encode()
-	purl.Path = strings.Replace(purl.Path, "sid=", "", -1)
-
-	if linkLimit != 0 {
-		path_parts := strings.Split(purl.Path, "/")
-		index := len(path_parts) - linkLimit
-		purl.Path = strings.Join(path_parts[0:index], "/")
-	}
-
-	if purl.IsAbs() {
-		return purl.String()
+		return "", err
 	}
+	return baseSelectorSnip(selector, page.Document)
 
-	// set absolute
-	purl.Scheme = surl.Scheme
-	purl.Host = surl.Host
-
-	return purl.String()
+}
 
+// absolute url of the link, normalized with the default url rules
+func SanitizeURL(scrapUrl, url string, linkLimit int) string {
+	return urlNormalizer{}.sanitize(scrapUrl, url, linkLimit)
 }
 
 func baseSelectorSnip(selector ScrapSelector, doc *goquery.Document) (string, error) {
@@ -641,19 +925,6 @@ func ExtractIdFromURL(u string, pathIndex int, split string, splitIndex int) (st
 
 }
 
-func GenerateStringKey(selector ScrapSelector) string {
-	// TODO review this, if the number of urls is high it could have hash collision
-	baseHash := selector.Url
-
-	hash := fnv.New32()
-	_, err := io.WriteString(hash, baseHash)
-	if err != nil {
-		log.Println(err)
-	}
-	return fmt.Sprintf("%v", hash.Sum32())
-
-}
-
 func prettyPrint(s []string) string {
 	var buffer bytes.Buffer
 
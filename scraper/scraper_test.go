@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -52,7 +53,7 @@ func TestBasicScrap(t *testing.T) {
 
 		scrapper := ScrapperFromReader(strings.NewReader(example1))
 
-		jobId, items, err := scrapper.Scrap(s)
+		jobId, items, err := scrapper.Scrap(context.Background(), s)
 		So(err, ShouldBeNil)
 		So(jobId, ShouldNotEqual, "")
 		t.Log("Items", items)
@@ -104,7 +105,7 @@ func TestScrapIdFromUrl(t *testing.T) {
 
 		scrapper := ScrapperFromReader(strings.NewReader(example1))
 
-		jobId, items, err := scrapper.Scrap(s)
+		jobId, items, err := scrapper.Scrap(context.Background(), s)
 
 		So(err, ShouldBeNil)
 		So(jobId, ShouldNotEqual, "")
@@ -206,7 +207,7 @@ func TestScrapIdFromLink(t *testing.T) {
 
 		scrapper := ScrapperFromReader(strings.NewReader(example1))
 
-		jobId, items, err := scrapper.Scrap(s)
+		jobId, items, err := scrapper.Scrap(context.Background(), s)
 
 		So(err, ShouldBeNil)
 		So(jobId, ShouldNotEqual, "")
@@ -441,7 +442,7 @@ func TestScrapIntegrationFromUrl(t *testing.T) {
 
 		scrapper := NewScrapper()
 
-		jobId, items, err := scrapper.Scrap(s)
+		jobId, items, err := scrapper.Scrap(context.Background(), s)
 
 		So(err, ShouldBeNil)
 		So(jobId, ShouldNotEqual, "")
@@ -495,9 +496,11 @@ func TestScrapIntegrationRecursiveFromUrl(t *testing.T) {
 		err := data.SaveSelector(sDetail)
 		So(err, ShouldBeNil)
 
+		detailRuns, _ := data.JobRuns("http://localhost:9999/item1.html")
+
 		scrapper := NewRecursiveScrapper()
 
-		jobId, items, err := scrapper.Scrap(sList)
+		jobId, items, err := scrapper.Scrap(context.Background(), sList)
 
 		So(err, ShouldBeNil)
 		So(jobId, ShouldNotEqual, "")
@@ -523,6 +526,11 @@ func TestScrapIntegrationRecursiveFromUrl(t *testing.T) {
 		So(result["item1.html"].Item.Link, ShouldEqual, "http://localhost/123")
 		So(result["item2.html"].Item.Link, ShouldEqual, "http://localhost/I2")
 		So(result["item3.html"].Item.Link, ShouldEqual, "http://localhost/I3")
+		So(result["item1.html"].JobId, ShouldEqual, jobId)
+
+		// the detail pages are scraped in the recursive job
+		runs, _ := data.JobRuns("http://localhost:9999/item1.html")
+		So(runs, ShouldResemble, detailRuns)
 
 	})
 }
@@ -1,10 +1,12 @@
 package scraper
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/url"
+	"time"
 
 	"github.com/dahernan/gopherscraper/elasticsearch"
 	"github.com/dahernan/gopherscraper/model"
@@ -16,6 +18,9 @@ type StorageItems interface {
 
 type ScrapAndStoreItems interface {
 	ScrapAndStore(selector ScrapSelector) (string, error)
+	ResumeAndStore(jobId string) error
+	// scraps the pages in a new job described by the selector
+	ScrapPagesAndStore(jobId string, selector ScrapSelector, pages []ScrapSelector) error
 }
 
 // Elastic Search storage
@@ -43,6 +48,15 @@ func (sto ElasticStorage) StoreItem(it ItemResult) {
 	index := itemIndex(it)
 	it.Item.Index = index
 
+	// already indexed by a previous scrap, it is fresh again
+	if it.Unchanged {
+		_, err = sto.elasticItem.UpdateLastScrap(&it.Item)
+		if err != nil {
+			log.Printf("ERROR Scrap [%v]:ElasticStorage in update the lastScrap of the item %v, with message %v", it.JobId, it.Item.Id, err.Error())
+		}
+		return
+	}
+
 	resp, err = sto.elasticItem.Put(&it.Item)
 
 	if err != nil {
@@ -72,6 +86,11 @@ func (sto RedisStorage) StoreItem(it ItemResult) {
 		log.Printf("ERROR Scrap [%v] RedisStorage:StoreItems with Item, with message %v", it.JobId, it.Err.Error())
 		sto.redis.client.HIncrBy(jobKeyMeta, "errors", 1)
 		sto.redis.client.HSet(jobKeyMeta, "lastError", it.Err.Error())
+		sto.redis.indexJob(scrapJobsErrorsKey, it.JobId)
+		return
+	}
+	if it.Unchanged {
+		sto.redis.client.HIncrBy(jobKeyMeta, "unchanged", 1)
 		return
 	}
 	index := itemIndex(it)
@@ -86,8 +105,8 @@ func (sto RedisStorage) StoreItem(it ItemResult) {
 	sto.redis.client.HSet(jobKey, index, string(b))
 	sto.redis.client.HIncrBy(jobKeyMeta, "items", 1)
 
-	defer sto.redis.client.Expire(jobKey, 60*10)     // 10 minutes
-	defer sto.redis.client.Expire(jobKeyMeta, 60*10) // 10 minutes
+	defer sto.redis.client.Expire(jobKey, 60*10) // 10 minutes
+	defer sto.redis.client.Expire(jobKeyMeta, jobRetention)
 
 }
 
@@ -103,7 +122,7 @@ func NewFileStorage() StorageItems {
 }
 
 func (sto FileStorage) StoreItem(it ItemResult) {
-	if it.Err != nil {
+	if it.Err != nil || it.Unchanged {
 		return
 	}
 
@@ -126,29 +145,81 @@ func NewScrapAndStore(sc ScrapperItems, storages []StorageItems) ScrapAndStoreIt
 	}
 }
 
+// the workers store the items of the queued jobs
 func NewElasticScrapAndStore(index string) ScrapAndStoreItems {
+	if jobQueue {
+		return NewQueueScrapAndStore()
+	}
 	return DefaultScrapAndStore{
 		scrapper: NewRecursiveScrapper(),
 		storages: []StorageItems{NewElasticStorage(index), NewRedisStorage(), NewFileStorage()},
 	}
 }
 
+// scraps again the archived pages with the current selector
+func NewElasticReExtractAndStore(index string) ScrapAndStoreItems {
+	return DefaultScrapAndStore{
+		scrapper: RecursiveScrapper{baseScrapper: NewArchiveScrapper()},
+		storages: []StorageItems{NewElasticStorage(index), NewRedisStorage(), NewFileStorage()},
+	}
+}
+
+// scraps the responses recorded in the WARC file
+func NewElasticWarcAndStore(index string, filename string) (ScrapAndStoreItems, error) {
+	warc, err := NewWarcScrapper(filename)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultScrapAndStore{
+		scrapper: RecursiveScrapper{baseScrapper: warc},
+		storages: []StorageItems{NewElasticStorage(index), NewRedisStorage(), NewFileStorage()},
+	}, nil
+}
+
+// the job runs in background until it finishes or it is cancelled with CancelJob
 func (ss DefaultScrapAndStore) ScrapAndStore(selector ScrapSelector) (string, error) {
 	rdata := NewRedisScrapdata()
 	rdata.SaveSelector(selector)
 
-	jobId, items, err := ss.scrapper.Scrap(selector)
+	jobId, items, err := ss.scrapper.Scrap(context.Background(), selector)
 	if err != nil {
 		return jobId, err
 	}
 
-	go ss.Store(items)
+	// the items left in the channel of a stopped job are not stored
+	go ss.Store(runContext(jobId), items)
 
 	return jobId, nil
 }
 
-func (ss DefaultScrapAndStore) Store(items chan ItemResult) {
+// resumes the paused job in background, fetching its pending pages
+func (ss DefaultScrapAndStore) ResumeAndStore(jobId string) error {
+	items, err := ResumeJob(jobId)
+	if err != nil {
+		return err
+	}
+
+	go ss.Store(runContext(jobId), items)
+
+	return nil
+}
+
+func (ss DefaultScrapAndStore) ScrapPagesAndStore(jobId string, selector ScrapSelector, pages []ScrapSelector) error {
+	items := ScrapPages(context.Background(), jobId, selector, pages)
+
+	go ss.Store(runContext(jobId), items)
+
+	return nil
+}
+
+// stores the items until the channel is closed, the items sent
+// after the context is done are discarded
+func (ss DefaultScrapAndStore) Store(ctx context.Context, items chan ItemResult) {
 	for it := range items {
+		if ctx.Err() != nil {
+			continue
+		}
+		observeItem(it, time.Now())
 		for i, _ := range ss.storages {
 			go ss.storages[i].StoreItem(it)
 		}
@@ -181,7 +252,14 @@ func itemIndex(it ItemResult) string {
 	}
 	item := it.Item
 
-	u, err := url.Parse(item.ScrapUrl)
+	pageUrl := item.ScrapUrl
+	if it.IndexFinalUrl && item.FinalUrl != "" {
+		pageUrl = item.FinalUrl
+	}
+	if it.IndexFinalUrl && item.CanonicalUrl != "" {
+		pageUrl = item.CanonicalUrl
+	}
+	u, err := url.Parse(pageUrl)
 	if err != nil {
 		return ""
 	}
@@ -0,0 +1,324 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	neturl "net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	redactedValue = "******"
+
+	defaultSessionCookiesTTL = 60 * 60 * 24
+)
+
+var (
+	ErrSessionNotFound = fmt.Errorf("Session not found")
+	ErrLoginFailed     = fmt.Errorf("Login failed, the session is still logged out")
+	ErrInvalidSession  = fmt.Errorf("InvalidSession it needs a host and a loginUrl, and a csrf selector for the csrfField")
+
+	// one login at a time per host
+	sessionLocks   = map[string]*sync.Mutex{}
+	sessionLocksMu sync.Mutex
+)
+
+// Login flow for a host, the scraps for the host reuse the cookies of the session
+type SessionSpec struct {
+	Host string `json:"host"`
+
+	// page with the login form, fetched before the login to get the csrf token
+	LoginPage string `json:"loginPage,omitempty"`
+	// where the login form is submitted
+	LoginUrl string `json:"loginUrl"`
+	Method   string `json:"method,omitempty"`
+	// form fields with the credentials
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// form field filled with the token extracted from the login page
+	CsrfField string   `json:"csrfField,omitempty"`
+	Csrf      Selector `json:"csrf,omitempty"`
+
+	// marker present in a page when the session is logged out
+	LoggedOut Selector `json:"loggedOut,omitempty"`
+
+	// seconds to keep the cookie jar in Redis
+	CookiesTTL int `json:"cookiesTTL,omitempty"`
+}
+
+// copy of the session safe to be returned by the API
+func (s SessionSpec) Redacted() SessionSpec {
+	dup := s
+	dup.Fields = make(map[string]string, len(s.Fields))
+	for k, _ := range s.Fields {
+		dup.Fields[k] = redactedValue
+	}
+	return dup
+}
+
+func (s SessionSpec) cookiesTTL() int {
+	if s.CookiesTTL <= 0 {
+		return defaultSessionCookiesTTL
+	}
+	return s.CookiesTTL
+}
+
+func (s SessionSpec) loggedOut(doc *goquery.Document) bool {
+	if s.LoggedOut.Exp == "" {
+		return false
+	}
+	return doc.Find(s.LoggedOut.Exp).Length() > 0
+}
+
+func validateSession(s SessionSpec) error {
+	if s.Host == "" || s.LoginUrl == "" {
+		return ErrInvalidSession
+	}
+	if s.CsrfField != "" && s.Csrf.Exp == "" {
+		return ErrInvalidSession
+	}
+	return nil
+}
+
+func sessionLock(host string) *sync.Mutex {
+	sessionLocksMu.Lock()
+	defer sessionLocksMu.Unlock()
+
+	l, ok := sessionLocks[host]
+	if !ok {
+		l = &sync.Mutex{}
+		sessionLocks[host] = l
+	}
+	return l
+}
+
+// session registered for the host of the url, or nil if there is none
+func sessionFor(scrapUrl string) (*SessionSpec, error) {
+	u, err := neturl.Parse(scrapUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewRedisScrapdata().Session(u.Host)
+	if err == ErrSessionNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// fetch the url of the selector using the session cookies,
+// and login again if the page is logged out
+func sessionFromUrl(ctx context.Context, session *SessionSpec, selector ScrapSelector, base *http.Client) (*fetchedPage, error) {
+	rdata := NewRedisScrapdata()
+
+	cookies, err := rdata.SessionCookies(session.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cookies) == 0 {
+		cookies, err = login(ctx, session, target, nil, base)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page, err := sessionDo(ctx, session, selector, cookies, base)
+	if err != nil {
+		return nil, err
+	}
+	if !session.loggedOut(page.Document) {
+		return page, nil
+	}
+
+	log.Printf("INFO: Session for %s is logged out, login again", session.Host)
+	cookies, err = login(ctx, session, target, cookies, base)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionDo(ctx, session, selector, cookies, base)
+}
+
+func sessionDo(ctx context.Context, session *SessionSpec, selector ScrapSelector, cookies []*http.Cookie, base *http.Client) (*fetchedPage, error) {
+	u, err := neturl.Parse(selector.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	// the login follows any redirect, only the page follows the policy
+	client, jar, err := sessionClient(redirectClient(selector, base), u, cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := newRequest(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	err = NewRedisScrapdata().SaveSessionCookies(session.Host, jar.Cookies(u), session.cookiesTTL())
+	if err != nil {
+		log.Printf("ERROR: Session for %s can not save the cookies %v", session.Host, err.Error())
+	}
+
+	page, _, err := pageFromResponse(selector, res)
+	return page, err
+}
+
+// logins and returns the cookies of the new session for the login and the target urls
+func login(ctx context.Context, session *SessionSpec, target *neturl.URL, cookies []*http.Cookie, base *http.Client) ([]*http.Cookie, error) {
+	lock := sessionLock(session.Host)
+	lock.Lock()
+	defer lock.Unlock()
+
+	rdata := NewRedisScrapdata()
+
+	// other request could have done the login while waiting for the lock
+	current, err := rdata.SessionCookies(session.Host)
+	if err == nil && len(current) > 0 && !sameCookies(current, cookies) {
+		return current, nil
+	}
+
+	loginUrl, err := neturl.Parse(session.LoginUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	client, jar, err := sessionClient(base, loginUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the login looks like the browser fetching the pages of the host
+	profile, err := headerProfileFor(ScrapSelector{Url: session.LoginUrl})
+	if err != nil {
+		return nil, err
+	}
+
+	form := neturl.Values{}
+	for k, v := range session.Fields {
+		form.Set(k, v)
+	}
+
+	if session.LoginPage != "" {
+		req, err := http.NewRequest("GET", session.LoginPage, nil)
+		if err != nil {
+			return nil, err
+		}
+		profile.setHeaders(req)
+
+		page, err := sessionPage(ctx, client, req)
+		if err != nil {
+			return nil, err
+		}
+		if session.CsrfField != "" {
+			form.Set(session.CsrfField, extractText(page.Selection, session.Csrf))
+		}
+	}
+
+	method := strings.ToUpper(session.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, session.LoginUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	profile.setHeaders(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	doc, err := sessionPage(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	if session.loggedOut(doc) {
+		return nil, ErrLoginFailed
+	}
+
+	// the cookies with other path than the login are only sent to the target
+	cookies = mergeCookies(jar.Cookies(loginUrl), jar.Cookies(target))
+	err = rdata.SaveSessionCookies(session.Host, cookies, session.cookiesTTL())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("INFO: Session for %s logged in", session.Host)
+	return cookies, nil
+}
+
+func sessionPage(ctx context.Context, client *http.Client, req *http.Request) (*goquery.Document, error) {
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	err = decodeBody(res, defaultValidation.MaxBodyBytes)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return goquery.NewDocumentFromResponse(res)
+}
+
+// copy of the client with a cookie jar loaded with the cookies
+func sessionClient(base *http.Client, u *neturl.URL, cookies []*http.Cookie) (*http.Client, http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	jar.SetCookies(u, cookies)
+
+	client := *base
+	client.Jar = jar
+
+	return &client, jar, nil
+}
+
+// cookies of both lists, the later ones replace the cookies with the same name
+func mergeCookies(a, b []*http.Cookie) []*http.Cookie {
+	merged := make([]*http.Cookie, 0, len(a)+len(b))
+	index := make(map[string]int)
+	for _, list := range [][]*http.Cookie{a, b} {
+		for _, c := range list {
+			if i, ok := index[c.Name]; ok {
+				merged[i] = c
+				continue
+			}
+			index[c.Name] = len(merged)
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+func sameCookies(a, b []*http.Cookie) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,160 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	loginPage = `<html><body><form><input name="csrf" value="tok3n"></form></body></html>`
+	loggedOut = `<html><body><div class="login-required">Please login</div></body></html>`
+)
+
+func newShopWithLogin(logins *int) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(loginPage))
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("csrf") != "tok3n" || r.PostForm.Get("password") != "secret" {
+			w.Write([]byte(loggedOut))
+			return
+		}
+		*logins++
+		http.SetCookie(w, &http.Cookie{Name: "sess", Value: "valid", Path: "/"})
+		w.Write([]byte("<html><body>welcome</body></html>"))
+	})
+	mux.HandleFunc("/prices", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("sess")
+		if err != nil || c.Value != "valid" {
+			w.Write([]byte(loggedOut))
+			return
+		}
+		w.Write([]byte(example1))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSessionLogin(t *testing.T) {
+	Convey("Scrap a page behind a login", t, func() {
+		logins := 0
+		ts := newShopWithLogin(&logins)
+		defer ts.Close()
+
+		u, _ := neturl.Parse(ts.URL)
+
+		session := SessionSpec{
+			Host:      u.Host,
+			LoginPage: ts.URL + "/login",
+			LoginUrl:  ts.URL + "/login",
+			Fields:    map[string]string{"user": "buyer", "password": "secret"},
+			CsrfField: "csrf",
+			Csrf:      Selector{Exp: "input[name=csrf]", Attr: "value"},
+			LoggedOut: Selector{Exp: ".login-required"},
+		}
+
+		data := NewRedisScrapdata()
+		err := data.SaveSession(session)
+		So(err, ShouldBeNil)
+		defer data.DeleteSession(u.Host)
+
+		s := ScrapSelector{
+			Url:  ts.URL + "/prices",
+			Base: ".product-info",
+		}
+
+		Convey("login and reuse the cookies", func() {
+			snip, err := SnippetBase(s)
+			So(err, ShouldBeNil)
+			So(snip, ShouldContainSubstring, "Test")
+
+			_, err = SnippetBase(s)
+			So(err, ShouldBeNil)
+			So(logins, ShouldEqual, 1)
+
+			cookies, err := data.SessionCookies(u.Host)
+			So(err, ShouldBeNil)
+			So(len(cookies), ShouldEqual, 1)
+			So(cookies[0].Value, ShouldEqual, "valid")
+		})
+
+		Convey("login again when the page is logged out", func() {
+			expired := []*http.Cookie{{Name: "sess", Value: "expired"}}
+			err := data.SaveSessionCookies(u.Host, expired, 60)
+			So(err, ShouldBeNil)
+
+			snip, err := SnippetBase(s)
+			So(err, ShouldBeNil)
+			So(snip, ShouldContainSubstring, "Test")
+			So(logins, ShouldEqual, 1)
+		})
+
+		Convey("fails with wrong credentials", func() {
+			session.Fields["password"] = "wrong"
+			err := data.SaveSession(session)
+			So(err, ShouldBeNil)
+
+			_, err = SnippetBase(s)
+			So(err, ShouldEqual, ErrLoginFailed)
+		})
+
+		Convey("credentials are redacted", func() {
+			fromRedis, err := data.Session(u.Host)
+			So(err, ShouldBeNil)
+			So(fromRedis.Redacted().Fields["password"], ShouldEqual, redactedValue)
+			So(fromRedis.Fields["password"], ShouldEqual, "secret")
+		})
+	})
+}
+
+func TestSessionCookiesOfTarget(t *testing.T) {
+	Convey("The cookies set for the path of the target are saved", t, func() {
+		logins := 0
+		mux := http.NewServeMux()
+		mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+			logins++
+			http.SetCookie(w, &http.Cookie{Name: "account", Value: "valid", Path: "/account"})
+			w.Write([]byte("<html><body>welcome</body></html>"))
+		})
+		mux.HandleFunc("/account/prices", func(w http.ResponseWriter, r *http.Request) {
+			c, err := r.Cookie("account")
+			if err != nil || c.Value != "valid" {
+				w.Write([]byte(loggedOut))
+				return
+			}
+			w.Write([]byte(example1))
+		})
+		ts := httptest.NewServer(mux)
+		defer ts.Close()
+
+		u, _ := neturl.Parse(ts.URL)
+
+		session := SessionSpec{
+			Host:      u.Host,
+			LoginUrl:  ts.URL + "/login",
+			Fields:    map[string]string{"user": "buyer"},
+			LoggedOut: Selector{Exp: ".login-required"},
+		}
+
+		data := NewRedisScrapdata()
+		err := data.SaveSession(session)
+		So(err, ShouldBeNil)
+		defer data.DeleteSession(u.Host)
+
+		snip, err := SnippetBase(ScrapSelector{Url: ts.URL + "/account/prices", Base: ".product-info"})
+		So(err, ShouldBeNil)
+		So(snip, ShouldContainSubstring, "Test")
+		So(logins, ShouldEqual, 1)
+
+		cookies, err := data.SessionCookies(u.Host)
+		So(err, ShouldBeNil)
+		So(len(cookies), ShouldEqual, 1)
+		So(cookies[0].Name, ShouldEqual, "account")
+	})
+}
@@ -0,0 +1,168 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	FetchErrorContentType = "contentType"
+	FetchErrorSize        = "size"
+	FetchErrorMarker      = "marker"
+)
+
+var (
+	defaultValidation ResponseValidation
+)
+
+func init() {
+	UseResponseValidation(ResponseValidation{
+		ContentTypes: []string{"text/html", "application/xhtml+xml"},
+		MaxBodyBytes: 10 * 1024 * 1024,
+	})
+}
+
+// Checks done to a response before scraping it
+type ResponseValidation struct {
+	// accepted status codes, by default any 2xx
+	AcceptStatus []int `json:"acceptStatus,omitempty"`
+	// accepted media types, a response without Content-Type is accepted
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	MaxBodyBytes int64    `json:"maxBodyBytes,omitempty"`
+
+	// soft-404 and block pages, found by a CSS selector or a text in the body
+	MustContain    []Marker `json:"mustContain,omitempty"`
+	MustNotContain []Marker `json:"mustNotContain,omitempty"`
+}
+
+type Marker struct {
+	Exp  string `json:"exp,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+func (m Marker) String() string {
+	if m.Exp != "" {
+		return m.Exp
+	}
+	return fmt.Sprintf("%q", m.Text)
+}
+
+func (m Marker) found(doc *goquery.Document, body []byte) bool {
+	if m.Exp != "" && doc.Find(m.Exp).Length() > 0 {
+		return true
+	}
+	if m.Text != "" && strings.Contains(string(body), m.Text) {
+		return true
+	}
+	return false
+}
+
+// default validation for all the selectors
+func UseResponseValidation(v ResponseValidation) {
+	defaultValidation = v
+}
+
+// max size of the bodies decompressed, for the selectors without their own max
+func UseMaxBodyBytes(max int64) {
+	defaultValidation.MaxBodyBytes = max
+}
+
+func validationFor(selector ScrapSelector) ResponseValidation {
+	if selector.Validation == nil {
+		return defaultValidation
+	}
+
+	v := *selector.Validation
+	if v.AcceptStatus == nil {
+		v.AcceptStatus = defaultValidation.AcceptStatus
+	}
+	if v.ContentTypes == nil {
+		v.ContentTypes = defaultValidation.ContentTypes
+	}
+	if v.MaxBodyBytes <= 0 {
+		v.MaxBodyBytes = defaultValidation.MaxBodyBytes
+	}
+	return v
+}
+
+func (v ResponseValidation) acceptStatus(status int) bool {
+	if len(v.AcceptStatus) == 0 {
+		return status >= 200 && status <= 299
+	}
+	for _, s := range v.AcceptStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (v ResponseValidation) acceptContentType(contentType string) bool {
+	if contentType == "" || len(v.ContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range v.ContentTypes {
+		if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// status and headers, before reading the body
+func (v ResponseValidation) validateResponse(pageUrl string, res *http.Response) error {
+	if !v.acceptStatus(res.StatusCode) {
+		return FetchError{Kind: FetchErrorStatus, Url: pageUrl, StatusCode: res.StatusCode, Msg: res.Status}
+	}
+
+	contentType := res.Header.Get("Content-Type")
+	if !v.acceptContentType(contentType) {
+		return FetchError{Kind: FetchErrorContentType, Url: pageUrl, StatusCode: res.StatusCode, Msg: "content type not accepted " + contentType}
+	}
+
+	if v.MaxBodyBytes > 0 && res.ContentLength > v.MaxBodyBytes {
+		return FetchError{Kind: FetchErrorSize, Url: pageUrl, StatusCode: res.StatusCode, Msg: fmt.Sprintf("body of %v bytes is bigger than %v", res.ContentLength, v.MaxBodyBytes)}
+	}
+	return nil
+}
+
+// reads the body up to the max size
+func (v ResponseValidation) readBody(pageUrl string, res *http.Response) ([]byte, error) {
+	if v.MaxBodyBytes <= 0 {
+		return ioutil.ReadAll(res.Body)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, v.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > v.MaxBodyBytes {
+		return nil, FetchError{Kind: FetchErrorSize, Url: pageUrl, StatusCode: res.StatusCode, Msg: fmt.Sprintf("body is bigger than %v bytes", v.MaxBodyBytes)}
+	}
+	return body, nil
+}
+
+// markers for soft-404 and block pages
+func (v ResponseValidation) validateDocument(pageUrl string, status int, doc *goquery.Document, body []byte) error {
+	for _, m := range v.MustContain {
+		if !m.found(doc, body) {
+			return FetchError{Kind: FetchErrorMarker, Url: pageUrl, StatusCode: status, Msg: "page does not contain " + m.String()}
+		}
+	}
+	for _, m := range v.MustNotContain {
+		if m.found(doc, body) {
+			return FetchError{Kind: FetchErrorMarker, Url: pageUrl, StatusCode: status, Msg: "page contains " + m.String()}
+		}
+	}
+	return nil
+}
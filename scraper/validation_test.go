@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newValidationServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(example1))
+	})
+	mux.HandleFunc("/missing.html", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(example1))
+	})
+	mux.HandleFunc("/catalogue.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	})
+	mux.HandleFunc("/big.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat(example1, 100)))
+	})
+	mux.HandleFunc("/soft404.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><h1>Sorry, product not found</h1></body></html>`))
+	})
+	mux.HandleFunc("/captcha.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div class="g-recaptcha"></div>` + example1 + `</body></html>`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func fetchErrorKind(err error) string {
+	fe, ok := err.(FetchError)
+	if !ok {
+		return ""
+	}
+	return fe.Kind
+}
+
+func TestResponseValidation(t *testing.T) {
+	Convey("Responses are validated before the scrap", t, func() {
+		ts := newValidationServer()
+		defer ts.Close()
+
+		s := ScrapSelector{
+			Base: ".product-info",
+			Validation: &ResponseValidation{
+				MaxBodyBytes:   4096,
+				MustContain:    []Marker{{Exp: ".product-info"}},
+				MustNotContain: []Marker{{Exp: ".g-recaptcha"}, {Text: "product not found"}},
+			},
+		}
+
+		Convey("valid page", func() {
+			s.Url = ts.URL + "/ok.html"
+			_, err := SnippetBase(s)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("status not accepted", func() {
+			s.Url = ts.URL + "/missing.html"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorStatus)
+			So(err.(FetchError).StatusCode, ShouldEqual, 404)
+		})
+
+		Convey("content type not accepted", func() {
+			s.Url = ts.URL + "/catalogue.pdf"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorContentType)
+		})
+
+		Convey("body too big", func() {
+			s.Url = ts.URL + "/big.html"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorSize)
+		})
+
+		Convey("soft 404", func() {
+			s.Url = ts.URL + "/soft404.html"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorMarker)
+		})
+
+		Convey("captcha page", func() {
+			s.Url = ts.URL + "/captcha.html"
+			_, err := SnippetBase(s)
+			So(fetchErrorKind(err), ShouldEqual, FetchErrorMarker)
+		})
+
+		Convey("the status code is recorded in the job meta", func() {
+			s.Url = ts.URL + "/missing.html"
+			jobId, items, err := NewScrapper().Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+			_, opened := <-items
+			So(opened, ShouldBeFalse)
+
+			job, err := NewRedisScrapdata().ScrapJob(jobId)
+			So(err, ShouldBeNil)
+			meta := job["meta"].(map[string]string)
+			So(meta["errors:status:404"], ShouldEqual, "1")
+			So(meta["lastError"], ShouldContainSubstring, "404")
+		})
+	})
+}
@@ -0,0 +1,496 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/textproto"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	warcVersion = "WARC/1.1"
+
+	// bigger bodies are recorded truncated
+	warcMaxBodyBytes = 10 * 1024 * 1024
+)
+
+var (
+	ErrInvalidWarc  = fmt.Errorf("InvalidWarc the file is not a WARC file")
+	ErrWarcNotFound = fmt.Errorf("WARC file not found")
+
+	// records the fetches, nil does not record them
+	warcWriter *WarcWriter
+)
+
+// record the requests and responses of every fetch in WARC files
+func UseWarcWriter(w *WarcWriter) {
+	warcWriter = w
+}
+
+// Writes gzipped WARC files, one gzip member per record,
+// rotating the files by size and age
+type WarcWriter struct {
+	Dir      string
+	Prefix   string
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	serial int
+}
+
+func NewWarcWriter(dir string, prefix string, maxBytes int64, maxAge time.Duration) *WarcWriter {
+	return &WarcWriter{Dir: dir, Prefix: prefix, MaxBytes: maxBytes, MaxAge: maxAge}
+}
+
+// Record of a WARC file
+type WarcRecord struct {
+	Header textproto.MIMEHeader
+	Block  []byte
+	// position of the record in the file
+	Offset int64
+}
+
+func (r *WarcRecord) Type() string {
+	return r.Header.Get("WARC-Type")
+}
+
+func (r *WarcRecord) TargetURI() string {
+	return r.Header.Get("WARC-Target-URI")
+}
+
+// records the request and the response of a fetch
+func (w *WarcWriter) WriteExchange(req *http.Request, reqBody []byte, res *http.Response, resBody []byte, truncated bool) error {
+	now := time.Now()
+	responseId := warcRecordId()
+
+	var resBlock bytes.Buffer
+	fmt.Fprintf(&resBlock, "HTTP/%d.%d %s\r\n", res.ProtoMajor, res.ProtoMinor, res.Status)
+	warcRedacted(res.Header, "Set-Cookie").Write(&resBlock)
+	resBlock.WriteString("\r\n")
+	resBlock.Write(resBody)
+
+	var reqBlock bytes.Buffer
+	fmt.Fprintf(&reqBlock, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	fmt.Fprintf(&reqBlock, "Host: %s\r\n", req.URL.Host)
+	warcRedacted(req.Header, credentialHeaders...).Write(&reqBlock)
+	reqBlock.WriteString("\r\n")
+	reqBlock.Write(reqBody)
+
+	response := textproto.MIMEHeader{}
+	response.Set("WARC-Type", "response")
+	response.Set("WARC-Record-ID", responseId)
+	response.Set("WARC-Date", now.UTC().Format(time.RFC3339))
+	response.Set("WARC-Target-URI", req.URL.String())
+	response.Set("Content-Type", "application/http;msgtype=response")
+	if truncated {
+		response.Set("WARC-Truncated", "length")
+	}
+
+	request := textproto.MIMEHeader{}
+	request.Set("WARC-Type", "request")
+	request.Set("WARC-Record-ID", warcRecordId())
+	request.Set("WARC-Date", now.UTC().Format(time.RFC3339))
+	request.Set("WARC-Target-URI", req.URL.String())
+	request.Set("WARC-Concurrent-To", responseId)
+	request.Set("Content-Type", "application/http;msgtype=request")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.rotate(now)
+	if err != nil {
+		return err
+	}
+	err = w.writeRecord(request, reqBlock.Bytes())
+	if err != nil {
+		return err
+	}
+	return w.writeRecord(response, resBlock.Bytes())
+}
+
+func (w *WarcWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// opens a new file when the current one is too big or too old
+func (w *WarcWriter) rotate(now time.Time) error {
+	if w.file != nil {
+		tooBig := w.MaxBytes > 0 && w.size >= w.MaxBytes
+		tooOld := w.MaxAge > 0 && now.Sub(w.opened) >= w.MaxAge
+		if !tooBig && !tooOld {
+			return nil
+		}
+		w.file.Close()
+		w.file = nil
+	}
+
+	err := os.MkdirAll(w.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.Prefix, now.UTC().Format("20060102150405"), w.serial)
+	f, err := os.OpenFile(filepath.Join(w.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+	w.opened = now
+
+	info := textproto.MIMEHeader{}
+	info.Set("WARC-Type", "warcinfo")
+	info.Set("WARC-Record-ID", warcRecordId())
+	info.Set("WARC-Date", now.UTC().Format(time.RFC3339))
+	info.Set("WARC-Filename", name)
+	info.Set("Content-Type", "application/warc-fields")
+	return w.writeRecord(info, []byte("software: gopherscraper\r\nformat: WARC File Format 1.1\r\n"))
+}
+
+func (w *WarcWriter) writeRecord(header textproto.MIMEHeader, block []byte) error {
+	digest := sha1.Sum(block)
+	header.Set("WARC-Block-Digest", "sha1:"+base32.StdEncoding.EncodeToString(digest[:]))
+	header.Set("Content-Length", strconv.Itoa(len(block)))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(warcVersion + "\r\n"))
+	// the WARC-Type goes first
+	fmt.Fprintf(gz, "WARC-Type: %s\r\n", header.Get("WARC-Type"))
+	for k, values := range header {
+		if k == "Warc-Type" {
+			continue
+		}
+		for _, v := range values {
+			fmt.Fprintf(gz, "%s: %s\r\n", warcFieldName(k), v)
+		}
+	}
+	gz.Write([]byte("\r\n"))
+	gz.Write(block)
+	gz.Write([]byte("\r\n\r\n"))
+	err := gz.Close()
+	if err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// copy of the headers without the credentials
+func warcRedacted(header http.Header, names ...string) http.Header {
+	dup := http.Header{}
+	for k, v := range header {
+		dup[k] = v
+	}
+	for _, name := range names {
+		if dup.Get(name) != "" {
+			dup.Set(name, redactedValue)
+		}
+	}
+	return dup
+}
+
+// textproto canonical names to the WARC ones, Warc-Record-Id is WARC-Record-ID
+func warcFieldName(k string) string {
+	k = strings.Replace(k, "Warc-", "WARC-", 1)
+	k = strings.Replace(k, "-Id", "-ID", 1)
+	k = strings.Replace(k, "-Uri", "-URI", 1)
+	return k
+}
+
+func warcRecordId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Transport recording the fetches in the WARC writer
+type warcTransport struct {
+	base   http.RoundTripper
+	writer *WarcWriter
+}
+
+// copy of the client recording its fetches, if there is a WARC writer
+func recordedClient(client *http.Client) *http.Client {
+	if warcWriter == nil {
+		return client
+	}
+	c := *client
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	c.Transport = warcTransport{base: base, writer: warcWriter}
+	return &c
+}
+
+func (t warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err == nil {
+			reqBody, _ = ioutil.ReadAll(body)
+			body.Close()
+		}
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	// the body read is given back to the caller with the rest
+	resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, warcMaxBodyBytes))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	truncated := len(resBody) >= warcMaxBodyBytes
+	res.Body = readCloser{io.MultiReader(bytes.NewReader(resBody), res.Body), res.Body}
+
+	err = t.writer.WriteExchange(req, reqBody, res, resBody, truncated)
+	if err != nil {
+		log.Printf("ERROR: WARC record for %s failed with message %v", req.URL, err.Error())
+	}
+	return res, nil
+}
+
+// Reads the records of a WARC file, gzipped or not
+type WarcReader struct {
+	counter *countingReader
+	br      *bufio.Reader
+	gzipped bool
+	// offset of the file where the reader started
+	start int64
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func NewWarcReader(r io.Reader) (*WarcReader, error) {
+	return newWarcReaderAt(r, 0)
+}
+
+func newWarcReaderAt(r io.Reader, start int64) (*WarcReader, error) {
+	counter := &countingReader{r: r}
+	br := bufio.NewReader(counter)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	gzipped := len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b
+	return &WarcReader{counter: counter, br: br, gzipped: gzipped, start: start}, nil
+}
+
+func (r *WarcReader) offset() int64 {
+	return r.start + r.counter.n - int64(r.br.Buffered())
+}
+
+// the next record, io.EOF at the end of the file
+func (r *WarcReader) Next() (*WarcRecord, error) {
+	offset := r.offset()
+
+	_, err := r.br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if !r.gzipped {
+		record, err := readWarcRecord(r.br)
+		if err != nil {
+			return nil, err
+		}
+		record.Offset = offset
+		return record, nil
+	}
+
+	// one gzip member per record
+	gz, err := gzip.NewReader(r.br)
+	if err != nil {
+		return nil, err
+	}
+	gz.Multistream(false)
+	record, err := readWarcRecord(bufio.NewReader(gz))
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, gz)
+	record.Offset = offset
+	return record, nil
+}
+
+func readWarcRecord(br *bufio.Reader) (*WarcRecord, error) {
+	tp := textproto.NewReader(br)
+	version, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, ErrInvalidWarc
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidWarc
+	}
+	block := make([]byte, length)
+	_, err = io.ReadFull(br, block)
+	if err != nil {
+		return nil, err
+	}
+	// the record ends with two new lines
+	end := make([]byte, 4)
+	io.ReadFull(br, end)
+
+	return &WarcRecord{Header: header, Block: block}, nil
+}
+
+// the http response of a response record
+func (r *WarcRecord) Response() (*http.Response, error) {
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+}
+
+// path of a WARC file written by the scraper
+func WarcFile(name string) (string, error) {
+	if warcWriter == nil {
+		return "", ErrWarcNotFound
+	}
+	filename := filepath.Join(warcWriter.Dir, filepath.Base(name))
+	_, err := os.Stat(filename)
+	if err != nil {
+		return "", ErrWarcNotFound
+	}
+	return filename, nil
+}
+
+// Scraps the responses recorded in a WARC file, the last response of every url is used
+func NewWarcScrapper(filename string) (ScrapperItems, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := NewWarcReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// offset of the response of every url
+	index := map[string]int64{}
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Type() == "response" {
+			index[record.TargetURI()] = record.Offset
+		}
+	}
+
+	document := func(selector ScrapSelector) (*fetchedPage, error) {
+		offset, ok := index[selector.Url]
+		if !ok {
+			return nil, FetchError{Kind: FetchErrorArchive, Url: selector.Url, Msg: "page not in the WARC file"}
+		}
+		return warcDocument(selector, filename, offset)
+	}
+	return OfflineScrapper{source: "W", document: document}, nil
+}
+
+func warcDocument(selector ScrapSelector, filename string, offset int64) (*fetchedPage, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newWarcReaderAt(f, offset)
+	if err != nil {
+		return nil, err
+	}
+	record, err := r.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := record.Response()
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	// the responses are recorded as they were received
+	err = decodeBody(res, validationFor(selector).MaxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	body, charset, err := decodeCharset(selector, raw, res.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	doc.Url, _ = neturl.Parse(record.TargetURI())
+	return &fetchedPage{Document: doc, charset: charset}, nil
+}
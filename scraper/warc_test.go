@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readWarcRecords(filename string) []*WarcRecord {
+	f, err := os.Open(filename)
+	So(err, ShouldBeNil)
+	defer f.Close()
+
+	r, err := NewWarcReader(f)
+	So(err, ShouldBeNil)
+
+	var records []*WarcRecord
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records
+		}
+		So(err, ShouldBeNil)
+		records = append(records, record)
+	}
+}
+
+func TestWarc(t *testing.T) {
+	Convey("The fetches are recorded in WARC files", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		dir, err := ioutil.TempDir("", "warc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		writer := NewWarcWriter(dir, "test", 0, 0)
+		UseWarcWriter(writer)
+		defer UseWarcWriter(nil)
+
+		s := ScrapSelector{
+			Url:     ts.URL + "/list.html",
+			Base:    ".product-info",
+			Title:   Selector{Exp: "h2"},
+			Request: RequestSpec{Headers: map[string]string{"Authorization": "Bearer secret"}},
+		}
+		_, err = SnippetBase(s)
+		So(err, ShouldBeNil)
+		writer.Close()
+
+		files, _ := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+		So(len(files), ShouldEqual, 1)
+
+		Convey("with request and response records", func() {
+			records := readWarcRecords(files[0])
+			So(records[0].Type(), ShouldEqual, "warcinfo")
+
+			var request, response *WarcRecord
+			for _, r := range records {
+				if r.TargetURI() != s.Url {
+					continue
+				}
+				switch r.Type() {
+				case "request":
+					request = r
+				case "response":
+					response = r
+				}
+			}
+			So(request, ShouldNotBeNil)
+			So(response, ShouldNotBeNil)
+			So(request.Header.Get("WARC-Concurrent-To"), ShouldEqual, response.Header.Get("WARC-Record-ID"))
+			So(string(request.Block), ShouldStartWith, "GET /list.html HTTP/1.1")
+			So(string(request.Block), ShouldNotContainSubstring, "secret")
+
+			res, err := response.Response()
+			So(err, ShouldBeNil)
+			So(res.StatusCode, ShouldEqual, 200)
+			body, _ := ioutil.ReadAll(res.Body)
+			So(string(body), ShouldEqual, example1)
+		})
+
+		Convey("a job can scrap the WARC file offline", func() {
+			ts.Close()
+			warc, err := NewWarcScrapper(files[0])
+			So(err, ShouldBeNil)
+
+			s.Title = Selector{Exp: "h2", Attr: "id"}
+			_, items, err := warc.Scrap(context.Background(), s)
+			So(err, ShouldBeNil)
+
+			var titles []string
+			for it := range items {
+				titles = append(titles, it.Item.Title)
+			}
+			So(titles, ShouldResemble, []string{"123", "124"})
+		})
+
+		Convey("the files are rotated by size", func() {
+			rotated := NewWarcWriter(dir, "rotated", 1, 0)
+			UseWarcWriter(rotated)
+			for i := 0; i < 3; i++ {
+				_, err = SnippetBase(s)
+				So(err, ShouldBeNil)
+			}
+			rotated.Close()
+
+			files, _ := filepath.Glob(filepath.Join(dir, "rotated-*.warc.gz"))
+			So(len(files), ShouldEqual, 3)
+		})
+	})
+
+	Convey("Uncompressed WARC files can be read", t, func() {
+		block := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + example1
+		warc := "WARC/1.0\r\nWARC-Type: response\r\nWARC-Target-URI: http://localhost/list.html\r\n" +
+			"Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n" + block + "\r\n\r\n"
+
+		r, err := NewWarcReader(strings.NewReader(warc + warc))
+		So(err, ShouldBeNil)
+
+		first, err := r.Next()
+		So(err, ShouldBeNil)
+		So(first.TargetURI(), ShouldEqual, "http://localhost/list.html")
+		So(string(first.Block), ShouldEqual, block)
+
+		second, err := r.Next()
+		So(err, ShouldBeNil)
+		So(second.Offset, ShouldEqual, len(warc))
+
+		_, err = r.Next()
+		So(err, ShouldEqual, io.EOF)
+	})
+}
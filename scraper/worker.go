@@ -0,0 +1,267 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	FetchErrorLease = "lease"
+
+	workerPollInterval = time.Second
+	// the status of the job is checked while its unit is processed
+	jobWatchInterval = time.Second
+)
+
+var (
+	// a unit without heartbeats for this time is queued again
+	queueLease time.Duration
+)
+
+func init() {
+	UseQueueLease(60)
+}
+
+func UseQueueLease(seconds int) {
+	queueLease = time.Duration(seconds) * time.Second
+}
+
+// Worker process, it leases the units of the queued jobs, scraps them and
+// stores the items. Many workers can run in different processes
+type Worker struct {
+	Id          string
+	Concurrency int
+	storages    []StorageItems
+}
+
+func NewWorker(concurrency int, storages []StorageItems) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		Id:          fmt.Sprintf("%s-%d", host, os.Getpid()),
+		Concurrency: concurrency,
+		storages:    storages,
+	}
+}
+
+func NewElasticWorker(index string, concurrency int) *Worker {
+	return NewWorker(concurrency, []StorageItems{NewElasticStorage(index), NewRedisStorage(), NewFileStorage()})
+}
+
+// runs until the context is done, the units in process are queued again
+func (w *Worker) Run(ctx context.Context) {
+	log.Printf("INFO: Worker [%s] started with concurrency %d\n", w.Id, w.Concurrency)
+	wg := &sync.WaitGroup{}
+
+	wg.Add(w.Concurrency + 1)
+	go w.requeueExpired(ctx, wg)
+	for i := 0; i < w.Concurrency; i++ {
+		go w.work(ctx, wg)
+	}
+
+	wg.Wait()
+	log.Printf("INFO: Worker [%s] stopped\n", w.Id)
+}
+
+func (w *Worker) work(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	data := NewRedisScrapdata()
+
+	for ctx.Err() == nil {
+		u, ok, err := data.LeaseUnit(queueLease)
+		if err != nil {
+			log.Printf("ERROR: Worker [%s] leasing a unit %v", w.Id, err.Error())
+		}
+		if !ok {
+			select {
+			case <-time.After(workerPollInterval):
+			case <-ctx.Done():
+			}
+			continue
+		}
+		w.process(ctx, u)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, u QueueUnit) {
+	data := NewRedisScrapdata()
+
+	// the units of the paused or cancelled jobs are dropped,
+	// the paused job keeps them pending
+	status, _ := data.JobStatus(u.JobId)
+	if status != JobStatusRunning {
+		data.AckUnit(u, false)
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go heartbeat(u.Id, done)
+
+	// the job can be paused or cancelled by other instance while the page is fetched
+	jobCtx, stopJob := context.WithCancel(ctx)
+	defer stopJob()
+	go watchJob(jobCtx, u.JobId, stopJob)
+
+	log.Printf("INFO: Worker [%s] Scrap [%s] GET from %s ", w.Id, u.JobId, u.Selector.Url)
+	var page *fetchedPage
+	s, err := withHeaderProfile(u.Selector)
+	if err == nil {
+		page, err = fromUrlWithRetry(jobCtx, u.JobId, s)
+	}
+	// the worker is stopping, another one takes the unit
+	if ctx.Err() != nil {
+		data.RetryUnit(u)
+		return
+	}
+	// the items of a stopped job are not stored
+	if status, _ := data.JobStatus(u.JobId); jobCtx.Err() != nil || status != JobStatusRunning {
+		data.AckUnit(u, false)
+		return
+	}
+	if err != nil {
+		if retryableUnit(s, err) && u.Attempts+1 < queueMaxAttempts {
+			log.Printf("INFO: Worker [%s] Scrap [%s] queued again %s, failed with %v", w.Id, u.JobId, s.Url, redactCredentials(err.Error()))
+			u.Attempts++
+			data.RetryUnit(u)
+			return
+		}
+		log.Printf("ERROR [%s] Scrapping %v with message %v", u.JobId, s.Url, redactCredentials(err.Error()))
+		data.JobError(u.JobId, err)
+		data.AckUnit(u, true)
+		return
+	}
+	page.detectBlocks = true
+
+	items := make(chan ItemResult, bufferItemsSize)
+	go func() {
+		documentScrap(jobCtx, u.JobId, s, page, items)
+		close(items)
+	}()
+	for it := range items {
+		if jobCtx.Err() != nil {
+			continue
+		}
+		w.handleItem(u, it)
+	}
+
+	if ctx.Err() != nil {
+		data.RetryUnit(u)
+		return
+	}
+	data.AckUnit(u, jobCtx.Err() == nil)
+}
+
+// cancels the unit when its job stops running
+func watchJob(ctx context.Context, jobId string, stop context.CancelFunc) {
+	data := NewRedisScrapdata()
+	for {
+		select {
+		case <-time.After(jobWatchInterval):
+		case <-ctx.Done():
+			return
+		}
+		if status, _ := data.JobStatus(jobId); status != JobStatusRunning {
+			stop()
+			return
+		}
+	}
+}
+
+// the list pages of a recursive job queue the detail pages of their items,
+// the other items are stored
+func (w *Worker) handleItem(u QueueUnit, it ItemResult) {
+	if u.Selector.Recursive {
+		rselector, err := RecursiveScrapper{}.recursiveSelector(it, u.Selector)
+		if err != nil {
+			return
+		}
+		NewRedisScrapdata().EnqueueUnit(QueueUnit{JobId: u.JobId, Selector: rselector})
+		return
+	}
+
+	observeItem(it, time.Now())
+	for i, _ := range w.storages {
+		w.storages[i].StoreItem(it)
+	}
+}
+
+// the failed page is tried again later, maybe by another worker
+func retryableUnit(s ScrapSelector, err error) bool {
+	if fe, ok := err.(FetchError); ok && fe.Kind == FetchErrorCoolDown {
+		return true
+	}
+	return retryPolicyFor(s).retryable(err)
+}
+
+// extends the lease of the unit until it is done
+func heartbeat(id string, done chan struct{}) {
+	data := NewRedisScrapdata()
+	for {
+		select {
+		case <-time.After(queueLease / 3):
+			data.HeartbeatUnit(id, queueLease)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (w *Worker) requeueExpired(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	unleased := map[string]bool{}
+	for {
+		select {
+		case <-time.After(queueLease / 2):
+		case <-ctx.Done():
+			return
+		}
+		unleased = requeueExpiredUnits(time.Now(), unleased)
+	}
+}
+
+// queues again the units whose lease expired, the worker processing them died.
+// A unit taken but not leased yet is queued again if it is still without lease
+// in the next check. It returns the units without lease
+func requeueExpiredUnits(now time.Time, unleased map[string]bool) map[string]bool {
+	data := NewRedisScrapdata()
+	next := map[string]bool{}
+
+	leases, err := data.LeasedUnits()
+	if err != nil {
+		log.Printf("ERROR: Worker checking the leases %v", err.Error())
+		return next
+	}
+
+	for id, expires := range leases {
+		if expires == 0 && !unleased[id] {
+			next[id] = true
+			continue
+		}
+		if expires > now.Unix() {
+			continue
+		}
+
+		u, err := data.QueuedUnit(id)
+		if err != nil {
+			// acked already
+			data.AckUnit(QueueUnit{Id: id}, false)
+			continue
+		}
+
+		u.Attempts++
+		if u.Attempts >= queueMaxAttempts {
+			log.Printf("ERROR [%s] Scrapping %v given up after %d leases", u.JobId, u.Selector.Url, u.Attempts)
+			data.JobError(u.JobId, FetchError{Kind: FetchErrorLease, Url: u.Selector.Url, Msg: fmt.Sprintf("given up after %d leases", u.Attempts)})
+			data.AckUnit(u, true)
+			continue
+		}
+		log.Printf("INFO: Scrap [%s] lease expired, queued again %s", u.JobId, u.Selector.Url)
+		data.RetryUnit(u)
+	}
+	return next
+}
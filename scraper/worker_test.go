@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// waits until the job is not running
+func waitJob(jobId string, timeout time.Duration) string {
+	rdata := NewRedisScrapdata()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		status, _ := rdata.JobStatus(jobId)
+		if status != JobStatusRunning {
+			return status
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	status, _ := rdata.JobStatus(jobId)
+	return status
+}
+
+// needs the test web serving at http://localhost:9999/list.html
+func TestQueuedJobs(t *testing.T) {
+	rdata := NewRedisScrapdata()
+
+	sList := ScrapSelector{
+		Stype:       SelectorTypeList,
+		Url:         "http://localhost:9999/list.html",
+		Base:        ".item",
+		Recursive:   true,
+		IdFrom:      SelectorIdFromLink,
+		IdExtractor: ExtractId{UrlPathIndex: -1},
+		Link:        Selector{Exp: "a", Attr: "href"},
+	}
+
+	Convey("The workers scrap the queued recursive job", t, func() {
+		err := rdata.SaveSelector(ScrapSelector{
+			Url:         "http://localhost:9999/item1.html",
+			Base:        ".product-info",
+			Stype:       SelectorTypeDetail,
+			IdFrom:      SelectorIdFromUrl,
+			IdExtractor: ExtractId{UrlPathIndex: -1},
+			Title:       Selector{Exp: "h2"},
+		})
+		So(err, ShouldBeNil)
+
+		jobId, err := NewQueueScrapAndStore().ScrapAndStore(sList)
+		So(err, ShouldBeNil)
+		So(jobId, ShouldStartWith, "R")
+		So(rdata.QueueLength(), ShouldEqual, 1)
+
+		ctx, stop := context.WithCancel(context.Background())
+		stopped := make(chan struct{})
+		go func() {
+			NewWorker(2, []StorageItems{NewRedisStorage()}).Run(ctx)
+			close(stopped)
+		}()
+
+		So(waitJob(jobId, 5*time.Second), ShouldEqual, JobStatusFinished)
+		stop()
+		<-stopped
+
+		job, err := rdata.ScrapJob(jobId)
+		So(err, ShouldBeNil)
+		meta := job["meta"].(map[string]string)
+		So(meta["items"], ShouldEqual, "3")
+		So(meta["queued"], ShouldEqual, "0")
+		So(job["pending"], ShouldEqual, 0)
+		So(rdata.QueueLength(), ShouldEqual, 0)
+	})
+
+	Convey("A paused job keeps its queued pages", t, func() {
+		jobId, err := EnqueueJob(sList)
+		So(err, ShouldBeNil)
+		So(PauseJob(jobId), ShouldBeNil)
+
+		// the worker drops the units of the paused job
+		u, ok, err := rdata.LeaseUnit(queueLease)
+		So(ok, ShouldBeTrue)
+		NewWorker(1, nil).process(context.Background(), u)
+		So(rdata.QueueLength(), ShouldEqual, 0)
+
+		status, _ := rdata.JobStatus(jobId)
+		So(status, ShouldEqual, JobStatusPaused)
+		pages, _ := rdata.PendingPages(jobId)
+		So(len(pages), ShouldEqual, 1)
+
+		So(NewQueueScrapAndStore().ResumeAndStore(jobId), ShouldBeNil)
+		So(rdata.QueueLength(), ShouldEqual, 1)
+		So(CancelJob(jobId), ShouldBeNil)
+
+		u, ok, err = rdata.LeaseUnit(queueLease)
+		So(ok, ShouldBeTrue)
+		NewWorker(1, nil).process(context.Background(), u)
+		status, _ = rdata.JobStatus(jobId)
+		So(status, ShouldEqual, JobStatusCancelled)
+	})
+
+	Convey("A job cancelled by other instance stops the unit in process", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			w.Write([]byte(example1))
+		}))
+		defer ts.Close()
+
+		jobId, err := EnqueueJob(ScrapSelector{Url: ts.URL + "/slow.html", Base: ".product-info", Title: Selector{Exp: "h2"}})
+		So(err, ShouldBeNil)
+		u, ok, _ := rdata.LeaseUnit(queueLease)
+		So(ok, ShouldBeTrue)
+
+		processed := make(chan struct{})
+		go func() {
+			NewWorker(1, []StorageItems{NewRedisStorage()}).process(context.Background(), u)
+			close(processed)
+		}()
+		time.Sleep(100 * time.Millisecond)
+		So(rdata.CancelJob(jobId), ShouldBeNil)
+
+		So(waitClosed(processed, 3*time.Second), ShouldBeTrue)
+		job, _ := rdata.ScrapJob(jobId)
+		meta := job["meta"].(map[string]string)
+		So(meta["status"], ShouldEqual, JobStatusCancelled)
+		So(meta["items"], ShouldEqual, "")
+		So(rdata.QueueLength(), ShouldEqual, 0)
+	})
+
+	Convey("A unit with an invalid selector does not stop the worker", t, func() {
+		jobId, err := EnqueueJob(ScrapSelector{Url: "http://localhost:9999/list.html", Base: "div[["})
+		So(err, ShouldBeNil)
+		u, ok, _ := rdata.LeaseUnit(queueLease)
+		So(ok, ShouldBeTrue)
+
+		So(func() { NewWorker(1, nil).process(context.Background(), u) }, ShouldNotPanic)
+		status, _ := rdata.JobStatus(jobId)
+		So(status, ShouldEqual, JobStatusFinished)
+	})
+
+	Convey("The units with expired leases are queued again", t, func() {
+		jobId, err := EnqueueJob(sList)
+		So(err, ShouldBeNil)
+
+		for attempt := 1; attempt <= queueMaxAttempts; attempt++ {
+			u, ok, err := rdata.LeaseUnit(queueLease)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(u.Attempts, ShouldEqual, attempt-1)
+
+			// the lease is alive
+			requeueExpiredUnits(time.Now(), map[string]bool{})
+			So(rdata.QueueLength(), ShouldEqual, 0)
+
+			requeueExpiredUnits(time.Now().Add(2*queueLease), map[string]bool{})
+		}
+
+		// given up
+		So(rdata.QueueLength(), ShouldEqual, 0)
+		So(waitJob(jobId, time.Second), ShouldEqual, JobStatusFinished)
+		job, _ := rdata.ScrapJob(jobId)
+		So(job["meta"].(map[string]string)["errors:"+FetchErrorLease], ShouldEqual, "1")
+	})
+}
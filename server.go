@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/codegangsta/negroni"
@@ -35,6 +40,44 @@ func main() {
 	viper.SetDefault("INDEX", "gopherscrap")
 	viper.SetDefault("USER_AGENT", "gopherscraper")
 	viper.SetDefault("MAX_CONNECTIONS", 500)
+	viper.SetDefault("ROBOTS", true)
+	viper.SetDefault("ROBOTS_TTL", 60*60*24)
+	viper.SetDefault("HOST_RATE", 5.0)
+	viper.SetDefault("HOST_BURST", 5)
+	viper.SetDefault("HOST_MAX_IN_FLIGHT", 4)
+	viper.SetDefault("RETRY_ATTEMPTS", 3)
+	viper.SetDefault("RETRY_BACKOFF_MS", 500)
+	viper.SetDefault("RETRY_MAX_BACKOFF_MS", 30*1000)
+	viper.SetDefault("COOLDOWN_SECONDS", 15*60)
+	viper.SetDefault("REDIRECT_MAX_HOPS", 10)
+	viper.SetDefault("ID_FALLBACK", scraper.IdFallbackLink)
+	viper.SetDefault("JOB_RETENTION_DAYS", 7)
+	viper.SetDefault("PROXIES", "")
+	viper.SetDefault("PROXY_STICKY", scraper.ProxyStickyHost)
+	viper.SetDefault("PROFILE_ROTATION", scraper.ProfileRotationNone)
+	viper.SetDefault("HTTP_CACHE_TTL", 60*60*24*7)
+	viper.SetDefault("MAX_BODY_MB", 10)
+	viper.SetDefault("ARCHIVE_DIR", "")
+	viper.SetDefault("ARCHIVE_S3_ENDPOINT", "")
+	viper.SetDefault("ARCHIVE_S3_BUCKET", "")
+	viper.SetDefault("ARCHIVE_S3_REGION", "us-east-1")
+	viper.SetDefault("ARCHIVE_S3_ACCESS_KEY", "")
+	viper.SetDefault("ARCHIVE_S3_SECRET_KEY", "")
+	viper.SetDefault("WARC_DIR", "")
+	viper.SetDefault("WARC_MAX_MB", 1024)
+	viper.SetDefault("WARC_MAX_MINUTES", 60)
+	// server scraps in process, api queues the jobs and worker scraps the queued jobs
+	viper.SetDefault("MODE", "server")
+	viper.SetDefault("WORKERS", 10)
+	viper.SetDefault("QUEUE_LEASE_SECONDS", 60)
+	viper.SetDefault("QUEUE_MAX_ATTEMPTS", 3)
+	viper.SetDefault("SCHEDULER", true)
+	viper.SetDefault("FRESHNESS_MAX_AGE_HOURS", 24)
+	viper.SetDefault("FRESHNESS_MIN_INTERVAL_HOURS", 1)
+	viper.SetDefault("FRESHNESS_MAX_INTERVAL_HOURS", 720)
+	viper.SetDefault("REFRESH_BUDGET", 500)
+	// 0 disables the periodic refresh
+	viper.SetDefault("REFRESH_MINUTES", 0)
 
 	rhost := viper.GetString("REDIS")
 	es := viper.GetString("ES")
@@ -42,6 +85,41 @@ func main() {
 	index := viper.GetString("INDEX")
 	userAgent := viper.GetString("USER_AGENT")
 	maxConnections := viper.GetInt("MAX_CONNECTIONS")
+	robots := viper.GetBool("ROBOTS")
+	robotsTTL := viper.GetInt("ROBOTS_TTL")
+	hostRate := viper.GetFloat64("HOST_RATE")
+	hostBurst := viper.GetInt("HOST_BURST")
+	hostMaxInFlight := viper.GetInt("HOST_MAX_IN_FLIGHT")
+	retryAttempts := viper.GetInt("RETRY_ATTEMPTS")
+	retryBackoff := viper.GetInt("RETRY_BACKOFF_MS")
+	retryMaxBackoff := viper.GetInt("RETRY_MAX_BACKOFF_MS")
+	coolDown := viper.GetInt("COOLDOWN_SECONDS")
+	redirectMaxHops := viper.GetInt("REDIRECT_MAX_HOPS")
+	idFallback := viper.GetString("ID_FALLBACK")
+	jobRetentionDays := viper.GetInt("JOB_RETENTION_DAYS")
+	proxies := viper.GetString("PROXIES")
+	proxySticky := viper.GetString("PROXY_STICKY")
+	// named pools, each one a comma separated list of proxies
+	proxyPools := viper.GetStringMapString("PROXY_POOLS")
+	profileRotation := viper.GetString("PROFILE_ROTATION")
+	httpCacheTTL := viper.GetInt("HTTP_CACHE_TTL")
+	maxBodyMB := viper.GetInt("MAX_BODY_MB")
+	archiveDir := viper.GetString("ARCHIVE_DIR")
+	archiveS3 := viper.GetString("ARCHIVE_S3_ENDPOINT")
+	archiveBucket := viper.GetString("ARCHIVE_S3_BUCKET")
+	warcDir := viper.GetString("WARC_DIR")
+	warcMaxMB := viper.GetInt("WARC_MAX_MB")
+	warcMaxMinutes := viper.GetInt("WARC_MAX_MINUTES")
+	mode := viper.GetString("MODE")
+	workers := viper.GetInt("WORKERS")
+	queueLease := viper.GetInt("QUEUE_LEASE_SECONDS")
+	queueMaxAttempts := viper.GetInt("QUEUE_MAX_ATTEMPTS")
+	scheduler := viper.GetBool("SCHEDULER")
+	freshnessMaxAge := viper.GetInt("FRESHNESS_MAX_AGE_HOURS")
+	freshnessMinInterval := viper.GetInt("FRESHNESS_MIN_INTERVAL_HOURS")
+	freshnessMaxInterval := viper.GetInt("FRESHNESS_MAX_INTERVAL_HOURS")
+	refreshBudget := viper.GetInt("REFRESH_BUDGET")
+	refreshMinutes := viper.GetInt("REFRESH_MINUTES")
 
 	log.Println("Using Redis: ", rhost)
 	log.Println("Using ES: ", es)
@@ -49,6 +127,38 @@ func main() {
 	log.Println("Using PORT: ", port)
 	log.Println("Using USER_AGENT: ", userAgent)
 	log.Println("Using MAX_CONNECTIONS: ", maxConnections)
+	log.Println("Using ROBOTS: ", robots)
+	log.Println("Using ROBOTS_TTL: ", robotsTTL)
+	log.Println("Using HOST_RATE: ", hostRate)
+	log.Println("Using HOST_BURST: ", hostBurst)
+	log.Println("Using HOST_MAX_IN_FLIGHT: ", hostMaxInFlight)
+	log.Println("Using RETRY_ATTEMPTS: ", retryAttempts)
+	log.Println("Using RETRY_BACKOFF_MS: ", retryBackoff)
+	log.Println("Using RETRY_MAX_BACKOFF_MS: ", retryMaxBackoff)
+	log.Println("Using COOLDOWN_SECONDS: ", coolDown)
+	log.Println("Using REDIRECT_MAX_HOPS: ", redirectMaxHops)
+	log.Println("Using ID_FALLBACK: ", idFallback)
+	log.Println("Using JOB_RETENTION_DAYS: ", jobRetentionDays)
+	log.Println("Using PROXY_STICKY: ", proxySticky)
+	log.Println("Using PROFILE_ROTATION: ", profileRotation)
+	log.Println("Using HTTP_CACHE_TTL: ", httpCacheTTL)
+	log.Println("Using MAX_BODY_MB: ", maxBodyMB)
+	log.Println("Using ARCHIVE_DIR: ", archiveDir)
+	log.Println("Using ARCHIVE_S3_ENDPOINT: ", archiveS3)
+	log.Println("Using ARCHIVE_S3_BUCKET: ", archiveBucket)
+	log.Println("Using WARC_DIR: ", warcDir)
+	log.Println("Using WARC_MAX_MB: ", warcMaxMB)
+	log.Println("Using WARC_MAX_MINUTES: ", warcMaxMinutes)
+	log.Println("Using MODE: ", mode)
+	log.Println("Using WORKERS: ", workers)
+	log.Println("Using QUEUE_LEASE_SECONDS: ", queueLease)
+	log.Println("Using QUEUE_MAX_ATTEMPTS: ", queueMaxAttempts)
+	log.Println("Using SCHEDULER: ", scheduler)
+	log.Println("Using FRESHNESS_MAX_AGE_HOURS: ", freshnessMaxAge)
+	log.Println("Using FRESHNESS_MIN_INTERVAL_HOURS: ", freshnessMinInterval)
+	log.Println("Using FRESHNESS_MAX_INTERVAL_HOURS: ", freshnessMaxInterval)
+	log.Println("Using REFRESH_BUDGET: ", refreshBudget)
+	log.Println("Using REFRESH_MINUTES: ", refreshMinutes)
 
 	redis.UseRedis(rhost)
 
@@ -56,7 +166,82 @@ func main() {
 	elastic.UserHandler(elastic.NewModelHandler(elasticRestClient))
 
 	scraper.UseUserAgent(userAgent)
+	scraper.UseProfileRotation(profileRotation)
+	scraper.UseHttpCache(httpCacheTTL)
+	scraper.UseMaxBodyBytes(int64(maxBodyMB) * 1024 * 1024)
+	if archiveS3 != "" {
+		scraper.UsePageArchive(scraper.NewS3Archive(archiveS3, archiveBucket, viper.GetString("ARCHIVE_S3_REGION"),
+			viper.GetString("ARCHIVE_S3_ACCESS_KEY"), viper.GetString("ARCHIVE_S3_SECRET_KEY")))
+	} else if archiveDir != "" {
+		scraper.UsePageArchive(scraper.NewDirArchive(archiveDir))
+	}
+	if warcDir != "" {
+		scraper.UseWarcWriter(scraper.NewWarcWriter(warcDir, "gopherscraper",
+			int64(warcMaxMB)*1024*1024, time.Duration(warcMaxMinutes)*time.Minute))
+	}
 	scraper.UseMaxConnections(maxConnections)
+	scraper.UseRobots(robots)
+	scraper.UseRobotsCacheTTL(robotsTTL)
+	scraper.UsePoliteness(scraper.Politeness{
+		RatePerSecond: hostRate,
+		Burst:         hostBurst,
+		MaxInFlight:   hostMaxInFlight,
+	})
+	scraper.UseRetryPolicy(scraper.RetryPolicy{
+		MaxAttempts:     retryAttempts,
+		BackoffMs:       retryBackoff,
+		MaxBackoffMs:    retryMaxBackoff,
+		MaxRetryAfterMs: 5 * 60 * 1000,
+		RetryStatus:     []int{408, 429, 500, 502, 503, 504},
+	})
+	scraper.UseBlockDetection(scraper.BlockDetection{
+		BlockStatus:     []int{403, 429},
+		StatusThreshold: 3,
+		ZeroMatchPages:  5,
+		CoolDownSeconds: coolDown,
+	})
+	scraper.UseIdFallback(idFallback)
+	scraper.UseJobRetention(jobRetentionDays * 60 * 60 * 24)
+	scraper.UseRedirectPolicy(scraper.RedirectPolicy{
+		MaxHops: redirectMaxHops,
+	})
+
+	proxyPools[scraper.DefaultProxyPool] = proxies
+	for name, list := range proxyPools {
+		err := scraper.UseProxyPool(name, strings.Split(list, ","), proxySticky)
+		if err != nil {
+			log.Fatalf("ERROR: Proxy pool %s: %v", name, err.Error())
+		}
+	}
+	for _, pool := range scraper.ProxyPools() {
+		log.Println("Using PROXY_POOL ", pool.Name, ": ", pool.Proxies())
+	}
+
+	scraper.UseJobQueue(mode == "api")
+	scraper.UseQueueLease(queueLease)
+	scraper.UseQueueMaxAttempts(queueMaxAttempts)
+	scraper.UseFreshness(scraper.Freshness{
+		MaxAgeSeconds:      freshnessMaxAge * 60 * 60,
+		MinIntervalSeconds: freshnessMinInterval * 60 * 60,
+		MaxIntervalSeconds: freshnessMaxInterval * 60 * 60,
+	})
+	scraper.UseRefreshBudget(refreshBudget)
+
+	if mode == "worker" {
+		// the units in process are queued again when the worker stops
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		scraper.NewElasticWorker(index, workers).Run(ctx)
+		return
+	}
+
+	// every instance runs it, the leader fires the schedules
+	if scheduler {
+		go scraper.NewScheduler(scraper.NewElasticScrapAndStore(index)).Run(context.Background())
+	}
+	if refreshMinutes > 0 {
+		go scraper.NewRefresher(index, scraper.NewElasticScrapAndStore(index)).Run(context.Background(), time.Duration(refreshMinutes)*time.Minute)
+	}
 
 	router := httprouter.New()
 	router.NotFound = NotFound
@@ -74,9 +259,43 @@ func main() {
 
 	router.POST("/api/scraper/test", scraperRoute.TestURL)
 	router.POST("/api/scraper/scrap", scraperRoute.Scrap)
+	router.POST("/api/scraper/reextract", scraperRoute.ReExtract)
+	router.POST("/api/scraper/warc/:file", scraperRoute.ScrapWarc)
 	router.POST("/api/scraper/selector", scraperRoute.Selector)
 	router.GET("/api/scraper/log", scraperRoute.Log)
+	router.GET("/api/scraper/audit", scraperRoute.Audit)
 	router.GET("/api/scraper/job/:id", scraperRoute.StatusJob)
+	router.DELETE("/api/scraper/job/:id", scraperRoute.CancelJob)
+	router.POST("/api/scraper/job/:id/pause", scraperRoute.PauseJob)
+	router.POST("/api/scraper/job/:id/resume", scraperRoute.ResumeJob)
+	router.GET("/api/scraper/jobs", scraperRoute.Jobs)
+	router.GET("/api/scraper/runs", scraperRoute.Runs)
+	router.POST("/api/scraper/session", scraperRoute.SaveSession)
+	router.GET("/api/scraper/session/:host", scraperRoute.Session)
+	router.DELETE("/api/scraper/session/:host", scraperRoute.DeleteSession)
+	router.POST("/api/scraper/politeness", scraperRoute.SavePoliteness)
+	router.GET("/api/scraper/politeness/:host", scraperRoute.Politeness)
+	router.DELETE("/api/scraper/politeness/:host", scraperRoute.DeletePoliteness)
+	router.GET("/api/scraper/profiles", scraperRoute.Profiles)
+	router.POST("/api/scraper/profile", scraperRoute.SaveProfile)
+	router.GET("/api/scraper/profile/:host", scraperRoute.Profile)
+	router.DELETE("/api/scraper/profile/:host", scraperRoute.DeleteProfile)
+	router.POST("/api/scraper/urlrules", scraperRoute.SaveUrlRules)
+	router.GET("/api/scraper/urlrules/:host", scraperRoute.UrlRules)
+	router.DELETE("/api/scraper/urlrules/:host", scraperRoute.DeleteUrlRules)
+	router.POST("/api/scraper/schedule", scraperRoute.SaveSchedule)
+	router.GET("/api/scraper/schedules", scraperRoute.Schedules)
+	router.GET("/api/scraper/schedule/:id", scraperRoute.Schedule)
+	router.DELETE("/api/scraper/schedule/:id", scraperRoute.DeleteSchedule)
+	router.POST("/api/scraper/freshness", scraperRoute.SaveFreshness)
+	router.GET("/api/scraper/freshness/:host", scraperRoute.Freshness)
+	router.DELETE("/api/scraper/freshness/:host", scraperRoute.DeleteFreshness)
+	router.GET("/api/scraper/freshness/:host/items/:id", scraperRoute.ItemChanges)
+	router.POST("/api/scraper/refresh", scraperRoute.Refresh)
+	router.GET("/api/scraper/cooldown", scraperRoute.CoolDowns)
+	router.GET("/api/scraper/cooldown/:host", scraperRoute.CoolDown)
+	router.DELETE("/api/scraper/cooldown/:host", scraperRoute.ClearCoolDown)
+	router.GET("/api/scraper/proxies", scraperRoute.Proxies)
 
 	n := negroni.Classic()
 	n.UseHandler(router)